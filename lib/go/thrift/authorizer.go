@@ -0,0 +1,151 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"crypto/x509"
+	"errors"
+	"strings"
+)
+
+// TAuthorizer decides whether a client may connect and which calls it may
+// make. Both methods return nil to allow and an error describing the
+// refusal otherwise.
+type TAuthorizer interface {
+	AuthorizeConnection(ctx *TConnectionContext) error
+	AuthorizeCall(ctx *TConnectionContext, call *TCallInfo) error
+}
+
+// TCertificateAuthorizer authorizes clients by the verified certificate
+// they presented during the TLS handshake. A certificate matches an
+// identity if its subject common name or any of its DNS, email or URI
+// subject alternative names is equal to it.
+type TCertificateAuthorizer struct {
+	// Identities allowed to connect. If empty, any verified certificate is
+	// accepted.
+	Allowed []string
+	// Identities allowed to call a method, keyed by "Service:method" or by
+	// method name. Methods not listed are open to every connected client.
+	// A call without a service name may reach the default processor of a
+	// TMultiplexedProcessor, so unless its method name is listed on its own
+	// it must pass every "Service:method" rule for that method.
+	Methods map[string][]string
+}
+
+// CertificateIdentities returns the names a certificate can be authorized
+// by: its subject common name followed by its subject alternative names.
+func CertificateIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		ids = append(ids, uri.String())
+	}
+	return ids
+}
+
+func certificateMatches(cert *x509.Certificate, allowed []string) bool {
+	for _, id := range CertificateIdentities(cert) {
+		for _, a := range allowed {
+			if id == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *TCertificateAuthorizer) AuthorizeConnection(ctx *TConnectionContext) error {
+	cert := ctx.PeerCertificate()
+	if cert == nil {
+		return errors.New("no verified client certificate")
+	}
+	if len(a.Allowed) > 0 && !certificateMatches(cert, a.Allowed) {
+		return errors.New("client certificate " + cert.Subject.String() + " is not allowed to connect")
+	}
+	return nil
+}
+
+func (a *TCertificateAuthorizer) AuthorizeCall(ctx *TConnectionContext, call *TCallInfo) error {
+	rules := a.callRules(call)
+	if len(rules) == 0 {
+		return nil
+	}
+	cert := ctx.PeerCertificate()
+	for _, allowed := range rules {
+		if cert == nil || !certificateMatches(cert, allowed) {
+			return errors.New("permission denied for " + call.Name())
+		}
+	}
+	return nil
+}
+
+// Returns the rules a call must pass.
+func (a *TCertificateAuthorizer) callRules(call *TCallInfo) [][]string {
+	if allowed, ok := a.Methods[call.Name()]; ok {
+		return [][]string{allowed}
+	}
+	if allowed, ok := a.Methods[call.Method]; ok {
+		return [][]string{allowed}
+	}
+	if call.Service != "" {
+		return nil
+	}
+	var rules [][]string
+	for name, allowed := range a.Methods {
+		if strings.HasSuffix(name, SEPARATOR+call.Method) {
+			rules = append(rules, allowed)
+		}
+	}
+	return rules
+}
+
+// NewAuthorizationProcessorMiddleware checks every call against
+// authorizer.AuthorizeCall. A refused call is skipped and answered with a
+// TApplicationException. The connection context is looked up from the
+// transport of the input protocol, so the middleware must run inside a
+// server that registers connection contexts.
+func NewAuthorizationProcessorMiddleware(authorizer TAuthorizer) ProcessorMiddleware {
+	return func(next ProcessorHandler) ProcessorHandler {
+		return func(call *TCallInfo, in, out TProtocol) (bool, TException) {
+			ctx, ok := GetConnectionContext(in.Transport())
+			if !ok {
+				ctx = &TConnectionContext{}
+			}
+			err := authorizer.AuthorizeCall(ctx, call)
+			if err == nil {
+				return next(call, in, out)
+			}
+			in.Skip(STRUCT)
+			in.ReadMessageEnd()
+			x := NewTApplicationException(UNKNOWN_APPLICATION_EXCEPTION, err.Error())
+			if call.TypeId == CALL {
+				out.WriteMessageBegin(call.Method, EXCEPTION, call.SeqId)
+				x.Write(out)
+				out.WriteMessageEnd()
+				out.Flush()
+			}
+			return false, x
+		}
+	}
+}
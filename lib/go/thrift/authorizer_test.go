@@ -0,0 +1,237 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// Test PKI: a CA and certificates it issued.
+type testPKI struct {
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	pool   *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate CA key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unable to create CA certificate: %s", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testPKI{caCert: cert, caKey: key, pool: pool}
+}
+
+// Issues a certificate for commonName, valid for both client and server
+// authentication on 127.0.0.1 and the given DNS names.
+func (p *testPKI) issue(t *testing.T, serial int64, commonName string, dnsNames ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.caCert, &key.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatalf("Unable to create certificate: %s", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func verifiedContext(cert tls.Certificate) *TConnectionContext {
+	return &TConnectionContext{TLSState: &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{cert.Leaf}},
+	}}
+}
+
+func TestCertificateAuthorizer(t *testing.T) {
+	pki := newTestPKI(t)
+	alice := verifiedContext(pki.issue(t, 2, "alice", "alice.example.com"))
+	bob := verifiedContext(pki.issue(t, 3, "bob"))
+	authorizer := &TCertificateAuthorizer{
+		Allowed: []string{"alice.example.com", "bob"},
+		Methods: map[string][]string{"Admin:shutdown": {"alice"}},
+	}
+
+	if err := authorizer.AuthorizeConnection(&TConnectionContext{}); err == nil {
+		t.Errorf("Expected a connection without certificate to be refused")
+	}
+	if err := authorizer.AuthorizeConnection(alice); err != nil {
+		t.Errorf("Expected alice to be allowed by SAN: %s", err)
+	}
+	if err := authorizer.AuthorizeConnection(verifiedContext(pki.issue(t, 4, "mallory"))); err == nil {
+		t.Errorf("Expected mallory to be refused")
+	}
+	shutdown := &TCallInfo{Service: "Admin", Method: "shutdown"}
+	if err := authorizer.AuthorizeCall(alice, shutdown); err != nil {
+		t.Errorf("Expected alice to be allowed to call shutdown: %s", err)
+	}
+	if err := authorizer.AuthorizeCall(bob, shutdown); err == nil {
+		t.Errorf("Expected bob to be refused shutdown")
+	}
+	if err := authorizer.AuthorizeCall(bob, &TCallInfo{Method: "echo"}); err != nil {
+		t.Errorf("Expected unlisted methods to be open: %s", err)
+	}
+}
+
+// A call without a service name dispatched to the default processor must
+// not bypass the rules of that processor's service.
+func TestCertificateAuthorizerDefaultProcessor(t *testing.T) {
+	pki := newTestPKI(t)
+	authorizer := &TCertificateAuthorizer{Methods: map[string][]string{"Admin:echo": {"alice"}}}
+	multiplexed := NewTMultiplexedProcessor()
+	multiplexed.RegisterProcessor("Admin", &testEchoProcessor{})
+	multiplexed.RegisterDefault(&testEchoProcessor{})
+	processor := WrapProcessor(multiplexed, NewAuthorizationProcessorMiddleware(authorizer))
+
+	call := func(ctx *TConnectionContext) (*TMemoryBuffer, TException) {
+		in := NewTMemoryBuffer()
+		writeTestCall(t, in, "echo", 7, 5)
+		out := NewTMemoryBuffer()
+		inProtocol := NewTBinaryProtocolTransport(in)
+		registerConnectionContext(ctx, inProtocol.Transport())
+		defer unregisterConnectionContext(inProtocol.Transport())
+		_, err := processor.Process(inProtocol, NewTBinaryProtocolTransport(out))
+		return out, err
+	}
+	out, err := call(verifiedContext(pki.issue(t, 2, "bob")))
+	if err == nil {
+		t.Fatal("Expected bob to be refused echo through the default processor")
+	}
+	expectMultiplexedException(t, out, "echo", UNKNOWN_APPLICATION_EXCEPTION)
+	if _, err := call(verifiedContext(pki.issue(t, 3, "alice"))); err != nil {
+		t.Fatalf("Expected alice to be allowed echo through the default processor: %s", err)
+	}
+	if err := authorizer.AuthorizeCall(&TConnectionContext{}, &TCallInfo{Service: "Other", Method: "echo"}); err != nil {
+		t.Errorf("Expected rules of other services not to apply: %s", err)
+	}
+}
+
+// Echo processor reporting the peer certificate seen by each call.
+type testTLSProcessor struct {
+	peer chan *x509.Certificate
+}
+
+func (p *testTLSProcessor) Process(in, out TProtocol) (bool, TException) {
+	ctx, _ := GetConnectionContext(in.Transport())
+	p.peer <- ctx.PeerCertificate()
+	return (&testEchoProcessor{}).Process(in, out)
+}
+
+func TestSimpleServerMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	serverCert := pki.issue(t, 2, "server")
+	serverConn, clientConn := net.Pipe()
+	server := NewTSSLSocketFromConnTimeout(tls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pki.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}), nil, time.Second)
+	client := NewTSSLSocketFromConnTimeout(tls.Client(clientConn, &tls.Config{
+		Certificates: []tls.Certificate{pki.issue(t, 3, "alice")},
+		RootCAs:      pki.pool,
+		ServerName:   "127.0.0.1",
+	}), nil, time.Second)
+	defer clientConn.Close()
+
+	peer := make(chan *x509.Certificate, 1)
+	srv := NewTSimpleServer2(&testTLSProcessor{peer}, nil)
+	srv.SetLogger(NopLogger)
+	srv.SetAuthorizer(&TCertificateAuthorizer{
+		Allowed: []string{"alice"},
+		Methods: map[string][]string{"forbidden": {"bob"}},
+	})
+	go srv.processRequest(server)
+
+	prot := NewTBinaryProtocolTransport(client)
+	c := NewTStandardClient(prot, prot)
+	result := &testCallStruct{}
+	if err := c.Call("echo", &testCallStruct{3}, result); err != nil {
+		t.Fatalf("Call() failed: %s", err)
+	}
+	if cert := <-peer; cert == nil || cert.Subject.CommonName != "alice" {
+		t.Fatalf("Handler did not see the client certificate, got %v", cert)
+	}
+	err := c.Call("forbidden", &testCallStruct{}, &testCallStruct{})
+	if e, ok := err.(TApplicationException); !ok || e.TypeId() != UNKNOWN_APPLICATION_EXCEPTION {
+		t.Fatalf("Expected the forbidden call to be refused but got %v", err)
+	}
+}
+
+func TestSimpleServerRefusesConnection(t *testing.T) {
+	pki := newTestPKI(t)
+	serverConn, clientConn := net.Pipe()
+	server := NewTSSLSocketFromConnTimeout(tls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{pki.issue(t, 2, "server")},
+		ClientCAs:    pki.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}), nil, time.Second)
+	client := tls.Client(clientConn, &tls.Config{
+		Certificates: []tls.Certificate{pki.issue(t, 3, "mallory")},
+		RootCAs:      pki.pool,
+		ServerName:   "127.0.0.1",
+	})
+	defer clientConn.Close()
+	go func() {
+		if client.Handshake() == nil {
+			ioutil.ReadAll(client)
+		}
+	}()
+
+	srv := NewTSimpleServer2(&testEchoProcessor{}, nil)
+	srv.SetAuthorizer(&TCertificateAuthorizer{Allowed: []string{"alice"}})
+	if err := srv.processRequest(server); err == nil {
+		t.Fatalf("Expected the connection to be refused")
+	}
+}
@@ -305,6 +305,9 @@ func (p *TBinaryProtocol) ReadMapBegin() (kType, vType TType, size int, err erro
 		err = NewTProtocolException(e)
 		return
 	}
+	if e := checkReadSize(size, MaxContainerSize, remainingBytes(p.trans)); e != nil {
+		return kType, vType, 0, e
+	}
 	return kType, vType, size, nil
 }
 
@@ -325,6 +328,9 @@ func (p *TBinaryProtocol) ReadListBegin() (elemType TType, size int, err error)
 		err = NewTProtocolException(e)
 		return
 	}
+	if e := checkReadSize(size, MaxContainerSize, remainingBytes(p.trans)); e != nil {
+		return elemType, 0, e
+	}
 	return elemType, size, nil
 }
 
@@ -345,6 +351,9 @@ func (p *TBinaryProtocol) ReadSetBegin() (elemType TType, size int, err error) {
 		err = NewTProtocolException(e)
 		return
 	}
+	if e := checkReadSize(size, MaxContainerSize, remainingBytes(p.trans)); e != nil {
+		return elemType, 0, e
+	}
 	return elemType, size, nil
 }
 
@@ -409,8 +418,10 @@ func (p *TBinaryProtocol) ReadBinary() ([]byte, error) {
 		return nil, e
 	}
 	isize := int(size)
-	buf := make([]byte, isize)
-	_, err := io.ReadFull(p.trans, buf)
+	if err := checkReadSize(isize, MaxStringSize, remainingBytes(p.trans)); err != nil {
+		return nil, err
+	}
+	buf, err := readSizedBytes(p.trans, isize)
 	return buf, NewTProtocolException(err)
 }
 
@@ -432,11 +443,9 @@ func (p *TBinaryProtocol) readAll(buf []byte) error {
 }
 
 func (p *TBinaryProtocol) readStringBody(size int) (value string, err error) {
-	if size < 0 {
-		return "", nil
+	if e := checkReadSize(size, MaxStringSize, remainingBytes(p.trans)); e != nil {
+		return "", e
 	}
-	isize := int(size)
-	buf := make([]byte, isize)
-	_, e := io.ReadFull(p.trans, buf)
+	buf, e := readSizedBytes(p.trans, size)
 	return string(buf), NewTProtocolException(e)
 }
@@ -101,6 +101,8 @@ func (p *TBufferedTransport) Flush() error {
 	for start < wbuf.pos {
 		n, err := p.tp.Write(wbuf.buffer[start:wbuf.pos])
 		if err != nil {
+			// Drop the rest, so that it does not precede the next message.
+			wbuf.pos = 0
 			return err
 		}
 		start += n
@@ -0,0 +1,417 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_CIRCUIT_CONSECUTIVE_FAILURES = 5
+	DEFAULT_CIRCUIT_ERROR_WINDOW         = 20
+	DEFAULT_CIRCUIT_OPEN_TIMEOUT         = 30 * time.Second
+	DEFAULT_CIRCUIT_HALF_OPEN_PROBES     = 1
+)
+
+type TCircuitState int
+
+const (
+	// Calls pass and their outcomes are counted.
+	CIRCUIT_CLOSED TCircuitState = iota
+	// Calls fail fast with NOT_OPEN.
+	CIRCUIT_OPEN
+	// A limited number of probe calls pass, the others fail fast.
+	CIRCUIT_HALF_OPEN
+)
+
+func (p TCircuitState) String() string {
+	switch p {
+	case CIRCUIT_CLOSED:
+		return "CIRCUIT_CLOSED"
+	case CIRCUIT_OPEN:
+		return "CIRCUIT_OPEN"
+	case CIRCUIT_HALF_OPEN:
+		return "CIRCUIT_HALF_OPEN"
+	}
+	return "<UNSET>"
+}
+
+type TCircuitBreakerOptions struct {
+	// Trip after this many failed calls in a row. Defaults to
+	// DEFAULT_CIRCUIT_CONSECUTIVE_FAILURES; negative disables it.
+	ConsecutiveFailures int
+	// Trip when the share of failed calls among the last ErrorWindow ones
+	// exceeds ErrorRatio. Zero disables it.
+	ErrorRatio  float64
+	ErrorWindow int
+	// How long the circuit stays open before probe calls are let through.
+	OpenTimeout time.Duration
+	// The number of probe calls let through while half-open. The circuit
+	// closes when they all succeed and opens again when one fails.
+	HalfOpenProbes int
+	// Decides which errors count as failures. Defaults to
+	// TTransportException and TApplicationException; other errors, like
+	// declared exceptions, count as successes.
+	IsFailure func(err error) bool
+	// Called after each change of state, outside of the breaker's lock.
+	OnStateChange func(from, to TCircuitState)
+}
+
+// The state and counters of a TCircuitBreaker.
+type TCircuitBreakerStatus struct {
+	State               TCircuitState
+	ConsecutiveFailures int
+	// Calls failed fast since the breaker was created.
+	Rejected int64
+}
+
+// TCircuitBreaker stops calling a service that keeps failing, so that
+// callers fail fast instead of piling up on timeouts. It is applied to calls
+// through Middleware, or to generated clients through Transport, and may be
+// shared by several clients of the same service. It is safe for concurrent
+// use.
+type TCircuitBreaker struct {
+	mu          sync.Mutex
+	options     TCircuitBreakerOptions
+	state       TCircuitState
+	generation  uint64
+	consecutive int
+	outcomes    tOutcomeWindow
+	openUntil   time.Time
+	probes      int
+	successes   int
+	rejected    int64
+	changes     [][2]TCircuitState
+}
+
+func NewTCircuitBreaker(options TCircuitBreakerOptions) *TCircuitBreaker {
+	if options.ConsecutiveFailures == 0 {
+		options.ConsecutiveFailures = DEFAULT_CIRCUIT_CONSECUTIVE_FAILURES
+	}
+	if options.ErrorWindow <= 0 {
+		options.ErrorWindow = DEFAULT_CIRCUIT_ERROR_WINDOW
+	}
+	if options.OpenTimeout <= 0 {
+		options.OpenTimeout = DEFAULT_CIRCUIT_OPEN_TIMEOUT
+	}
+	if options.HalfOpenProbes <= 0 {
+		options.HalfOpenProbes = DEFAULT_CIRCUIT_HALF_OPEN_PROBES
+	}
+	if options.IsFailure == nil {
+		options.IsFailure = isCircuitFailure
+	}
+	return &TCircuitBreaker{options: options}
+}
+
+func isCircuitFailure(err error) bool {
+	switch err.(type) {
+	case TTransportException, TApplicationException:
+		return true
+	}
+	return false
+}
+
+// Returns the current state. An open circuit whose timeout has passed
+// reports CIRCUIT_OPEN until the next call makes it half-open.
+func (b *TCircuitBreaker) State() TCircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *TCircuitBreaker) Status() TCircuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return TCircuitBreakerStatus{State: b.state, ConsecutiveFailures: b.consecutive, Rejected: b.rejected}
+}
+
+// Middleware returns a ClientMiddleware that guards calls with b.
+func (b *TCircuitBreaker) Middleware() ClientMiddleware {
+	return func(next TClient) TClient {
+		return TClientFunc(func(method string, args, result TStruct) (err error) {
+			generation, err := b.allow()
+			if err != nil {
+				return err
+			}
+			// A call that panics still releases its probe slot, as a failure.
+			err = NewTTransportException(UNKNOWN_TRANSPORT_EXCEPTION, "Call panicked")
+			defer func() {
+				b.done(generation, err)
+			}()
+			err = next.Call(method, args, result)
+			return err
+		})
+	}
+}
+
+// Transport wraps the transport of a client, typically the one passed to a
+// generated client factory, with b. Open and every request are guarded like
+// calls: they fail with NOT_OPEN while the circuit is open, and failures to
+// connect count. A successful Open is not counted, the calls made on the
+// connection are. A request is allowed when it is first written. Its
+// outcome is the first transport error until its reply starts to arrive.
+// The transport cannot tell oneway requests from calls still waiting for
+// their reply, so a flushed request is only counted as a success once the
+// next request is written, and not counted at all if the transport is
+// closed first. Only transport errors are seen here, so
+// TApplicationExceptions are not counted; Wrap counts them as well.
+func (b *TCircuitBreaker) Transport(trans TTransport) TTransport {
+	return &tCircuitBreakerTransport{TTransport: trans, breaker: b}
+}
+
+// Wrap guards a generated client with b, counting exception replies and
+// oneway requests, which Transport cannot tell apart. It returns the
+// transport and protocol factory to pass to the generated client factory:
+//
+//	trans, protocolFactory := breaker.Wrap(transport, thrift.NewTBinaryProtocolFactoryDefault())
+//	client := tutorial.NewCalculatorClientFactory(trans, protocolFactory)
+//
+// Calls are guarded as with Transport, except that a call only succeeds
+// once its reply has been read, an EXCEPTION reply counts as a
+// TApplicationException, and a oneway request succeeds once flushed.
+func (b *TCircuitBreaker) Wrap(trans TTransport, protocolFactory TProtocolFactory) (TTransport, TProtocolFactory) {
+	wrapped := &tCircuitBreakerTransport{TTransport: trans, breaker: b, tracked: true}
+	return wrapped, &tCircuitBreakerProtocolFactory{trans: wrapped, protocolFactory: protocolFactory}
+}
+
+// Lets a call through, returning the generation its outcome belongs to, or
+// fails it fast.
+func (b *TCircuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.unlock()
+	if b.state == CIRCUIT_OPEN {
+		if time.Now().Before(b.openUntil) {
+			b.rejected++
+			return 0, NewTTransportException(NOT_OPEN, "Circuit breaker open")
+		}
+		b.setState(CIRCUIT_HALF_OPEN)
+	}
+	if b.state == CIRCUIT_HALF_OPEN {
+		if b.probes >= b.options.HalfOpenProbes {
+			b.rejected++
+			return 0, NewTTransportException(NOT_OPEN, "Circuit breaker half-open")
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+// Gives back the probe slot of a call let through in generation without
+// counting an outcome.
+func (b *TCircuitBreaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.unlock()
+	if generation == b.generation && b.state == CIRCUIT_HALF_OPEN {
+		b.probes--
+	}
+}
+
+// Records the outcome of a call let through in generation. Outcomes of
+// calls started before the last change of state are ignored.
+func (b *TCircuitBreaker) done(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.unlock()
+	if generation != b.generation {
+		return
+	}
+	failed := err != nil && b.options.IsFailure(err)
+	switch b.state {
+	case CIRCUIT_HALF_OPEN:
+		if failed {
+			b.trip()
+		} else if b.successes++; b.successes >= b.options.HalfOpenProbes {
+			b.setState(CIRCUIT_CLOSED)
+		}
+	case CIRCUIT_CLOSED:
+		if failed {
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+		ratio := b.outcomes.record(!failed, b.options.ErrorWindow)
+		if (b.options.ConsecutiveFailures > 0 && b.consecutive >= b.options.ConsecutiveFailures) ||
+			(b.options.ErrorRatio > 0 && ratio > b.options.ErrorRatio) {
+			b.trip()
+		}
+	}
+}
+
+func (b *TCircuitBreaker) trip() {
+	b.setState(CIRCUIT_OPEN)
+	b.openUntil = time.Now().Add(b.options.OpenTimeout)
+}
+
+// Changes the state and starts a new generation with fresh counters.
+func (b *TCircuitBreaker) setState(state TCircuitState) {
+	b.changes = append(b.changes, [2]TCircuitState{b.state, state})
+	b.state = state
+	b.generation++
+	b.consecutive, b.probes, b.successes = 0, 0, 0
+	b.outcomes.reset()
+}
+
+// Unlocks b and reports the changes of state made while it was locked.
+func (b *TCircuitBreaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+	if b.options.OnStateChange != nil {
+		for _, change := range changes {
+			b.options.OnStateChange(change[0], change[1])
+		}
+	}
+}
+
+type tCircuitBreakerTransport struct {
+	TTransport
+	breaker    *TCircuitBreaker
+	active     bool
+	sent       bool
+	generation uint64
+	// Set by Wrap, whose protocols report message types and reply ends.
+	tracked bool
+	oneway  bool
+}
+
+// Starts a request unless one is being written.
+func (p *tCircuitBreakerTransport) begin() error {
+	if p.active && !p.sent {
+		return nil
+	}
+	if p.tracked {
+		p.finish(NewTTransportException(UNKNOWN_TRANSPORT_EXCEPTION, "Request ended without a complete reply"))
+	} else {
+		p.finish(nil)
+	}
+	generation, err := p.breaker.allow()
+	if err != nil {
+		return err
+	}
+	p.active, p.sent, p.generation = true, false, generation
+	return nil
+}
+
+// Ends the current request, if any, with the outcome err.
+func (p *tCircuitBreakerTransport) finish(err error) {
+	if p.active {
+		p.active = false
+		p.breaker.done(p.generation, err)
+	}
+}
+
+func (p *tCircuitBreakerTransport) Open() error {
+	generation, err := p.breaker.allow()
+	if err != nil {
+		return err
+	}
+	if err := p.TTransport.Open(); err != nil {
+		p.breaker.done(generation, NewTTransportExceptionFromError(err))
+		return err
+	}
+	p.breaker.release(generation)
+	return nil
+}
+
+func (p *tCircuitBreakerTransport) Write(buf []byte) (int, error) {
+	if err := p.begin(); err != nil {
+		return 0, err
+	}
+	n, err := p.TTransport.Write(buf)
+	if err != nil {
+		p.finish(NewTTransportExceptionFromError(err))
+	}
+	return n, err
+}
+
+func (p *tCircuitBreakerTransport) Flush() error {
+	err := p.TTransport.Flush()
+	if err != nil {
+		p.finish(NewTTransportExceptionFromError(err))
+	} else if p.active && p.oneway {
+		p.finish(nil)
+	} else if p.active {
+		p.sent = true
+	}
+	return err
+}
+
+func (p *tCircuitBreakerTransport) Read(buf []byte) (int, error) {
+	n, err := p.TTransport.Read(buf)
+	if err != nil {
+		p.finish(NewTTransportExceptionFromError(err))
+	} else if n > 0 && p.sent && !p.tracked {
+		p.finish(nil)
+	}
+	return n, err
+}
+
+// A request still being written, or a call whose reply has not been read,
+// is abandoned and fails. A flushed request whose kind is not known may
+// have been oneway and is not counted.
+func (p *tCircuitBreakerTransport) Close() error {
+	if p.active && p.sent && !p.tracked {
+		p.active = false
+		p.breaker.release(p.generation)
+	}
+	p.finish(NewTTransportException(NOT_OPEN, "Transport closed before the reply"))
+	return p.TTransport.Close()
+}
+
+type tCircuitBreakerProtocolFactory struct {
+	trans           *tCircuitBreakerTransport
+	protocolFactory TProtocolFactory
+}
+
+// Tracks the calls made on the transport returned by Wrap. Protocols for
+// other transports are not guarded.
+func (f *tCircuitBreakerProtocolFactory) GetProtocol(trans TTransport) TProtocol {
+	protocol := f.protocolFactory.GetProtocol(trans)
+	if trans != TTransport(f.trans) {
+		return protocol
+	}
+	return &tCircuitBreakerProtocol{TProtocol: protocol, trans: f.trans}
+}
+
+type tCircuitBreakerProtocol struct {
+	TProtocol
+	trans *tCircuitBreakerTransport
+}
+
+func (p *tCircuitBreakerProtocol) WriteMessageBegin(name string, typeId TMessageType, seqid int32) error {
+	p.trans.oneway = typeId == ONEWAY
+	return p.TProtocol.WriteMessageBegin(name, typeId, seqid)
+}
+
+func (p *tCircuitBreakerProtocol) ReadMessageBegin() (name string, typeId TMessageType, seqid int32, err error) {
+	name, typeId, seqid, err = p.TProtocol.ReadMessageBegin()
+	if err == nil && typeId == EXCEPTION {
+		p.trans.finish(NewTApplicationException(UNKNOWN_APPLICATION_EXCEPTION, "Exception reply to "+name))
+	}
+	return
+}
+
+func (p *tCircuitBreakerProtocol) ReadMessageEnd() error {
+	err := p.TProtocol.ReadMessageEnd()
+	if err == nil && p.trans.sent {
+		p.trans.finish(nil)
+	}
+	return err
+}
@@ -0,0 +1,303 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type testCircuitChanges [][2]TCircuitState
+
+func (p *testCircuitChanges) record(from, to TCircuitState) {
+	*p = append(*p, [2]TCircuitState{from, to})
+}
+
+func TestCircuitBreakerMiddleware(t *testing.T) {
+	var changes testCircuitChanges
+	breaker := NewTCircuitBreaker(TCircuitBreakerOptions{
+		ConsecutiveFailures: 3,
+		OpenTimeout:         20 * time.Millisecond,
+		OnStateChange:       changes.record,
+	})
+	var calls int
+	var result error
+	client := WrapClient(TClientFunc(func(method string, args, res TStruct) error {
+		calls++
+		return result
+	}), breaker.Middleware())
+
+	result = NewTTransportException(TIMED_OUT, "timeout")
+	for i := 0; i < 3; i++ {
+		client.Call("echo", &testCallStruct{}, &testCallStruct{})
+	}
+	if breaker.State() != CIRCUIT_OPEN {
+		t.Fatalf("Expected the circuit to be open, got %s", breaker.State())
+	}
+	err := client.Call("echo", &testCallStruct{}, &testCallStruct{})
+	if e, ok := err.(TTransportException); !ok || e.TypeId() != NOT_OPEN || calls != 3 {
+		t.Fatalf("Expected a fast NOT_OPEN failure, got %v after %d calls", err, calls)
+	}
+
+	// A failed probe opens the circuit again, a successful one closes it.
+	time.Sleep(30 * time.Millisecond)
+	result = NewTApplicationException(INTERNAL_ERROR, "broken")
+	client.Call("echo", &testCallStruct{}, &testCallStruct{})
+	if breaker.State() != CIRCUIT_OPEN || calls != 4 {
+		t.Fatalf("Expected the failed probe to open the circuit, got %s after %d calls", breaker.State(), calls)
+	}
+	time.Sleep(30 * time.Millisecond)
+	result = nil
+	if err := client.Call("echo", &testCallStruct{}, &testCallStruct{}); err != nil {
+		t.Fatalf("Probe failed: %s", err)
+	}
+	status := breaker.Status()
+	if status.State != CIRCUIT_CLOSED || status.Rejected != 1 {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+	expected := testCircuitChanges{
+		{CIRCUIT_CLOSED, CIRCUIT_OPEN},
+		{CIRCUIT_OPEN, CIRCUIT_HALF_OPEN},
+		{CIRCUIT_HALF_OPEN, CIRCUIT_OPEN},
+		{CIRCUIT_OPEN, CIRCUIT_HALF_OPEN},
+		{CIRCUIT_HALF_OPEN, CIRCUIT_CLOSED},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected changes %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatalf("Expected changes %v, got %v", expected, changes)
+		}
+	}
+}
+
+func TestCircuitBreakerErrorRatio(t *testing.T) {
+	breaker := NewTCircuitBreaker(TCircuitBreakerOptions{ConsecutiveFailures: -1, ErrorRatio: 0.5, ErrorWindow: 4})
+	results := []error{
+		nil,
+		NewTTransportException(END_OF_FILE, "eof"),
+		errors.New("declared exception"),
+		NewTApplicationException(INTERNAL_ERROR, "broken"),
+		NewTTransportException(END_OF_FILE, "eof"),
+	}
+	var result error
+	client := WrapClient(TClientFunc(func(method string, args, res TStruct) error {
+		return result
+	}), breaker.Middleware())
+	for i := range results {
+		if breaker.State() != CIRCUIT_CLOSED {
+			t.Fatalf("Circuit opened after %d calls", i)
+		}
+		result = results[i]
+		client.Call("echo", &testCallStruct{}, &testCallStruct{})
+	}
+	if breaker.State() != CIRCUIT_OPEN {
+		t.Fatalf("Expected the circuit to be open, got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	breaker := NewTCircuitBreaker(TCircuitBreakerOptions{ConsecutiveFailures: 1, OpenTimeout: time.Millisecond})
+	release := make(chan struct{})
+	started := make(chan struct{})
+	client := WrapClient(TClientFunc(func(method string, args, res TStruct) error {
+		if method == "slow" {
+			close(started)
+			<-release
+			return nil
+		}
+		return NewTTransportException(TIMED_OUT, "timeout")
+	}), breaker.Middleware())
+
+	client.Call("fail", &testCallStruct{}, &testCallStruct{})
+	time.Sleep(5 * time.Millisecond)
+	done := make(chan error)
+	go func() { done <- client.Call("slow", &testCallStruct{}, &testCallStruct{}) }()
+	<-started
+	if err := client.Call("slow", &testCallStruct{}, &testCallStruct{}); err == nil {
+		t.Fatal("Expected a second probe to be rejected")
+	}
+	close(release)
+	if err := <-done; err != nil || breaker.State() != CIRCUIT_CLOSED {
+		t.Fatalf("Expected the probe to close the circuit, got %v and %s", err, breaker.State())
+	}
+}
+
+func TestCircuitBreakerMiddlewarePanic(t *testing.T) {
+	breaker := NewTCircuitBreaker(TCircuitBreakerOptions{ConsecutiveFailures: 1, OpenTimeout: time.Millisecond})
+	client := WrapClient(TClientFunc(func(method string, args, res TStruct) error {
+		switch method {
+		case "panic":
+			panic("boom")
+		case "fail":
+			return NewTTransportException(TIMED_OUT, "timeout")
+		}
+		return nil
+	}), breaker.Middleware())
+	call := func(method string) (err error) {
+		defer func() {
+			if recover() != nil {
+				err = errors.New("panicked")
+			}
+		}()
+		return client.Call(method, &testCallStruct{}, &testCallStruct{})
+	}
+
+	call("fail")
+	time.Sleep(5 * time.Millisecond)
+	if err := call("panic"); err == nil || err.Error() != "panicked" {
+		t.Fatalf("Expected the probe to panic, got %v", err)
+	}
+	if breaker.State() != CIRCUIT_OPEN {
+		t.Fatalf("Expected a panicking probe to open the circuit, got %s", breaker.State())
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := call("echo"); err != nil || breaker.State() != CIRCUIT_CLOSED {
+		t.Fatalf("Expected the next probe to close the circuit, got %v and %s", err, breaker.State())
+	}
+}
+
+// Accepts writes and times out every read.
+type testTimeoutTransport struct {
+	writes int
+}
+
+func (p *testTimeoutTransport) Open() error  { return nil }
+func (p *testTimeoutTransport) Close() error { return nil }
+func (p *testTimeoutTransport) IsOpen() bool { return true }
+func (p *testTimeoutTransport) Peek() bool   { return true }
+func (p *testTimeoutTransport) Flush() error { return nil }
+
+func (p *testTimeoutTransport) Read(buf []byte) (int, error) {
+	return 0, NewTTransportException(TIMED_OUT, "timeout")
+}
+
+func (p *testTimeoutTransport) Write(buf []byte) (int, error) {
+	p.writes++
+	return len(buf), nil
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	breaker := NewTCircuitBreaker(TCircuitBreakerOptions{ConsecutiveFailures: 2})
+	trans := &testTimeoutTransport{}
+	p := NewTBinaryProtocolTransport(breaker.Transport(trans))
+	client := NewTStandardClient(p, p)
+	for i := 0; i < 2; i++ {
+		err := client.Call("echo", &testCallStruct{}, &testCallStruct{})
+		if e, ok := err.(TTransportException); !ok || e.TypeId() != TIMED_OUT {
+			t.Fatalf("Expected TIMED_OUT, got %v", err)
+		}
+	}
+	writes := trans.writes
+	err := client.Call("echo", &testCallStruct{}, &testCallStruct{})
+	if e, ok := err.(TTransportException); !ok || e.TypeId() != NOT_OPEN {
+		t.Fatalf("Expected NOT_OPEN, got %v", err)
+	}
+	if trans.writes != writes || breaker.State() != CIRCUIT_OPEN {
+		t.Fatalf("Expected a fast failure, got %d writes in state %s", trans.writes-writes, breaker.State())
+	}
+}
+
+func TestCircuitBreakerTransportOpen(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() failed: %s", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	breaker := NewTCircuitBreaker(TCircuitBreakerOptions{ConsecutiveFailures: 1})
+	sock, err := NewTSocketTimeout(addr, time.Second)
+	if err != nil {
+		t.Fatalf("NewTSocketTimeout() failed: %s", err)
+	}
+	trans := breaker.Transport(sock)
+	if err := trans.Open(); err == nil {
+		t.Fatal("Expected Open() to fail")
+	}
+	err = trans.Open()
+	if e, ok := err.(TTransportException); !ok || e.TypeId() != NOT_OPEN || breaker.State() != CIRCUIT_OPEN {
+		t.Fatalf("Expected a failed Open() to trip the circuit, got %v in state %s", err, breaker.State())
+	}
+}
+
+func TestCircuitBreakerTransportClose(t *testing.T) {
+	for _, wrap := range []bool{false, true} {
+		breaker := NewTCircuitBreaker(TCircuitBreakerOptions{ConsecutiveFailures: 1})
+		var trans TTransport
+		var p TProtocol
+		if wrap {
+			var f TProtocolFactory
+			trans, f = breaker.Wrap(&testTimeoutTransport{}, NewTBinaryProtocolFactoryDefault())
+			p = f.GetProtocol(trans)
+		} else {
+			trans = breaker.Transport(&testTimeoutTransport{})
+			p = NewTBinaryProtocolTransport(trans)
+		}
+		if err := NewTStandardClient(p, p).Send(p, 1, "echo", &testCallStruct{}, false); err != nil {
+			t.Fatalf("Send() failed: %s", err)
+		}
+		trans.Close()
+		// Transport cannot tell the call from a oneway request and leaves it
+		// unrecorded.
+		if wrap && breaker.State() != CIRCUIT_OPEN {
+			t.Fatalf("Expected a call abandoned by Close to count as a failure, got %s", breaker.State())
+		}
+		if status := breaker.Status(); !wrap && (status.State != CIRCUIT_CLOSED || status.ConsecutiveFailures != 0) {
+			t.Fatalf("Expected a flushed request closed by Close not to be counted, got %+v", status)
+		}
+	}
+}
+
+func TestCircuitBreakerWrap(t *testing.T) {
+	breaker := NewTCircuitBreaker(TCircuitBreakerOptions{ConsecutiveFailures: 1, OpenTimeout: time.Millisecond})
+	buf := NewTMemoryBuffer()
+	trans, f := breaker.Wrap(buf, NewTBinaryProtocolFactoryDefault())
+	client := NewTStandardClient(f.GetProtocol(trans), f.GetProtocol(trans))
+
+	writeTestReply(t, NewTBinaryProtocolTransport(buf), "echo", EXCEPTION, 1, NewTApplicationException(INTERNAL_ERROR, "boom"))
+	if err := client.Call("echo", &testCallStruct{}, &testCallStruct{}); err == nil {
+		t.Fatal("Expected the exception reply to fail the call")
+	}
+	if breaker.State() != CIRCUIT_OPEN {
+		t.Fatalf("Expected an exception reply to trip the circuit, got %s", breaker.State())
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	buf.Reset()
+	if err := client.Call("notify", &testCallStruct{}, nil); err != nil {
+		t.Fatalf("Call() failed: %s", err)
+	}
+	if breaker.State() != CIRCUIT_CLOSED {
+		t.Fatalf("Expected a flushed oneway request to close the circuit, got %s", breaker.State())
+	}
+
+	buf.Reset()
+	writeTestReply(t, NewTBinaryProtocolTransport(buf), "echo", REPLY, 3, &testCallStruct{42})
+	res := &testCallStruct{}
+	if err := client.Call("echo", &testCallStruct{}, res); err != nil || res.Value != 42 {
+		t.Fatalf("Expected 42, got %d and %v", res.Value, err)
+	}
+	if status := breaker.Status(); status.State != CIRCUIT_CLOSED || status.ConsecutiveFailures != 0 {
+		t.Fatalf("Expected a successful call, got %+v", status)
+	}
+}
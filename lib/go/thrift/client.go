@@ -0,0 +1,122 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+// TClient is the call interface shared by service clients. It hides the
+// message framing, sequence ids and TApplicationException handling that
+// each client method would otherwise have to repeat, and is the point at
+// which client middleware is applied.
+type TClient interface {
+	// Call sends a request for method with the given args and reads the
+	// reply into result. A nil result marks a oneway call, for which no
+	// reply is read.
+	Call(method string, args, result TStruct) error
+}
+
+// TStandardClient implements TClient on top of a pair of protocols. Like
+// the generated clients it is not safe for concurrent use.
+type TStandardClient struct {
+	seqId        int32
+	iprot, oprot TProtocol
+}
+
+// NewTStandardClient creates a TStandardClient that writes requests to
+// outputProtocol and reads replies from inputProtocol.
+func NewTStandardClient(inputProtocol, outputProtocol TProtocol) *TStandardClient {
+	return &TStandardClient{iprot: inputProtocol, oprot: outputProtocol}
+}
+
+// Send writes a single request message. Oneway requests, signalled by
+// oneway, are sent with the ONEWAY message type.
+func (p *TStandardClient) Send(oprot TProtocol, seqId int32, method string, args TStruct, oneway bool) error {
+	typeId := CALL
+	if oneway {
+		typeId = ONEWAY
+	}
+	if err := oprot.WriteMessageBegin(method, typeId, seqId); err != nil {
+		return err
+	}
+	if err := args.Write(oprot); err != nil {
+		return err
+	}
+	if err := oprot.WriteMessageEnd(); err != nil {
+		return err
+	}
+	return oprot.Flush()
+}
+
+// Recv reads the reply to the request seqId for method into result. An
+// EXCEPTION reply is returned as a TApplicationException. A reply that does
+// not match the request is read to its end and rejected, so that the
+// connection can carry on with the next call.
+func (p *TStandardClient) Recv(iprot TProtocol, seqId int32, method string, result TStruct) error {
+	rMethod, rTypeId, rSeqId, err := iprot.ReadMessageBegin()
+	if err != nil {
+		return err
+	}
+	if method != rMethod {
+		return skipReply(iprot, NewTApplicationException(WRONG_METHOD_NAME, method+": wrong method name"))
+	}
+	if seqId != rSeqId {
+		return skipReply(iprot, NewTApplicationException(BAD_SEQUENCE_ID, method+": out of sequence response"))
+	}
+	if rTypeId == EXCEPTION {
+		exception, err := NewTApplicationException(UNKNOWN_APPLICATION_EXCEPTION, "Unknown Exception").Read(iprot)
+		if err != nil {
+			return err
+		}
+		if err = iprot.ReadMessageEnd(); err != nil {
+			return err
+		}
+		return exception
+	}
+	if rTypeId != REPLY {
+		return skipReply(iprot, NewTApplicationException(INVALID_MESSAGE_TYPE_EXCEPTION, method+": invalid message type"))
+	}
+	if err = result.Read(iprot); err != nil {
+		return err
+	}
+	return iprot.ReadMessageEnd()
+}
+
+// Skips the body of a rejected reply and returns err, or the error that
+// prevented reading the reply to its end.
+func skipReply(iprot TProtocol, err error) error {
+	if e := iprot.Skip(STRUCT); e != nil {
+		return e
+	}
+	if e := iprot.ReadMessageEnd(); e != nil {
+		return e
+	}
+	return err
+}
+
+func (p *TStandardClient) Call(method string, args, result TStruct) error {
+	p.seqId++
+	seqId := p.seqId
+
+	if err := p.Send(p.oprot, seqId, method, args, result == nil); err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return p.Recv(p.iprot, seqId, method, result)
+}
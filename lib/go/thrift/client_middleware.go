@@ -0,0 +1,229 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ClientMiddleware wraps a TClient with additional behaviour. The returned
+// TClient sees the method name, args and result of every call and is
+// expected to delegate to next.
+type ClientMiddleware func(next TClient) TClient
+
+// TClientFunc adapts an ordinary function to the TClient interface.
+type TClientFunc func(method string, args, result TStruct) error
+
+func (f TClientFunc) Call(method string, args, result TStruct) error {
+	return f(method, args, result)
+}
+
+// WrapClient applies the middlewares to client. The first middleware is the
+// outermost one, so it sees each call first and its result last.
+func WrapClient(client TClient, middlewares ...ClientMiddleware) TClient {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		client = middlewares[i](client)
+	}
+	return client
+}
+
+// NewLoggingClientMiddleware logs one line per call with the method name,
+// duration and error.
+func NewLoggingClientMiddleware(logger Logger) ClientMiddleware {
+	if logger == nil {
+		logger = StdLogger(nil)
+	}
+	return func(next TClient) TClient {
+		return TClientFunc(func(method string, args, result TStruct) error {
+			start := time.Now()
+			err := next.Call(method, args, result)
+			logger(fmt.Sprintf("thrift client call: method=%q oneway=%t duration=%s error=%v",
+				method, result == nil, time.Since(start), err))
+			return err
+		})
+	}
+}
+
+// RetryPolicy configures NewRetryClientMiddleware.
+type RetryPolicy struct {
+	// Total number of attempts, including the first one.
+	MaxAttempts int
+	// Delay before the first retry. Each further retry multiplies the delay
+	// by Multiplier, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// TTransportException type ids that are retried. Defaults to NOT_OPEN,
+	// which fails before anything is sent. TIMED_OUT and END_OF_FILE may
+	// leave a half written request or a late reply on the connection, so
+	// only add them when the transport drops the connection after any
+	// failed read or write and reopens it for the next request, as
+	// TReconnectingTransport does.
+	RetryableTypes []int
+}
+
+// DefaultRetryPolicy retries twice, starting at 50ms.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 50 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Multiplier:     2,
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	e, ok := err.(TTransportException)
+	if !ok {
+		return false
+	}
+	types := p.RetryableTypes
+	if types == nil {
+		types = []int{NOT_OPEN}
+	}
+	for _, t := range types {
+		if e.TypeId() == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the delay before the given retry, counting from 1.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry; i++ {
+		if p.Multiplier > 1 {
+			d = time.Duration(float64(d) * p.Multiplier)
+		}
+		if p.MaxBackoff > 0 && d > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return d
+}
+
+// NewRetryClientMiddleware retries calls failing with a retryable
+// TTransportException, sleeping with exponential backoff in between. A
+// retry is sent as a brand new call, so it should be combined with a
+// transport that reopens broken connections. The server may already have
+// executed a failed call, so only use it for clients of idempotent methods.
+func NewRetryClientMiddleware(policy RetryPolicy) ClientMiddleware {
+	return newRetryClientMiddleware(policy, time.Sleep)
+}
+
+func newRetryClientMiddleware(policy RetryPolicy, sleep func(time.Duration)) ClientMiddleware {
+	return func(next TClient) TClient {
+		return TClientFunc(func(method string, args, result TStruct) (err error) {
+			for attempt := 1; ; attempt++ {
+				err = next.Call(method, args, result)
+				if err == nil || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+					return err
+				}
+				sleep(policy.backoff(attempt))
+			}
+		})
+	}
+}
+
+// MethodStats holds the counters ClientMetrics keeps for one method.
+type MethodStats struct {
+	Calls        int64
+	Errors       int64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+}
+
+// Returns the mean latency of all calls, or 0 if there were none.
+func (s MethodStats) MeanLatency() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Calls)
+}
+
+// ClientMetrics collects per-method call counts and latencies. It is safe
+// for concurrent use and may be shared by several clients.
+type ClientMetrics struct {
+	mu      sync.Mutex
+	methods map[string]*MethodStats
+}
+
+func NewClientMetrics() *ClientMetrics {
+	return &ClientMetrics{methods: make(map[string]*MethodStats)}
+}
+
+// Middleware returns a ClientMiddleware that records into m.
+func (m *ClientMetrics) Middleware() ClientMiddleware {
+	return func(next TClient) TClient {
+		return TClientFunc(func(method string, args, result TStruct) error {
+			start := time.Now()
+			err := next.Call(method, args, result)
+			m.record(method, time.Since(start), err)
+			return err
+		})
+	}
+}
+
+func (m *ClientMetrics) record(method string, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.methods[method]
+	if !ok {
+		s = &MethodStats{}
+		m.methods[method] = s
+	}
+	s.Calls++
+	if err != nil {
+		s.Errors++
+	}
+	s.TotalLatency += latency
+	if latency > s.MaxLatency {
+		s.MaxLatency = latency
+	}
+}
+
+// Stats returns the counters recorded for method.
+func (m *ClientMetrics) Stats(method string) MethodStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.methods[method]; ok {
+		return *s
+	}
+	return MethodStats{}
+}
+
+// Snapshot returns a copy of the counters of every method seen so far.
+func (m *ClientMetrics) Snapshot() map[string]MethodStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]MethodStats, len(m.methods))
+	for method, s := range m.methods {
+		snapshot[method] = *s
+	}
+	return snapshot
+}
+
+// Reset clears all counters.
+func (m *ClientMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.methods = make(map[string]*MethodStats)
+}
@@ -0,0 +1,150 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrapClientOrder(t *testing.T) {
+	var calls []string
+	tag := func(name string) ClientMiddleware {
+		return func(next TClient) TClient {
+			return TClientFunc(func(method string, args, result TStruct) error {
+				calls = append(calls, name)
+				return next.Call(method, args, result)
+			})
+		}
+	}
+	client := WrapClient(TClientFunc(func(method string, args, result TStruct) error {
+		calls = append(calls, method)
+		return nil
+	}), tag("first"), tag("second"))
+	if err := client.Call("echo", &testCallStruct{}, &testCallStruct{}); err != nil {
+		t.Fatalf("Call() failed: %s", err)
+	}
+	if strings.Join(calls, ",") != "first,second,echo" {
+		t.Fatalf("Unexpected middleware order %v", calls)
+	}
+}
+
+func TestLoggingClientMiddleware(t *testing.T) {
+	var lines []string
+	logger := func(msg string) { lines = append(lines, msg) }
+	client := WrapClient(TClientFunc(func(method string, args, result TStruct) error {
+		return errors.New("boom")
+	}), NewLoggingClientMiddleware(logger))
+	client.Call("echo", &testCallStruct{}, &testCallStruct{})
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 log line but got %d", len(lines))
+	}
+	if !strings.Contains(lines[0], `method="echo"`) || !strings.Contains(lines[0], "error=boom") {
+		t.Fatalf("Unexpected log line %q", lines[0])
+	}
+}
+
+func TestRetryClientMiddleware(t *testing.T) {
+	attempts := 0
+	var sleeps []time.Duration
+	policy := RetryPolicy{MaxAttempts: 4, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 25 * time.Millisecond, Multiplier: 2}
+	client := WrapClient(TClientFunc(func(method string, args, result TStruct) error {
+		attempts++
+		if attempts < 4 {
+			return NewTTransportException(NOT_OPEN, "not open")
+		}
+		return nil
+	}), newRetryClientMiddleware(policy, func(d time.Duration) { sleeps = append(sleeps, d) }))
+	if err := client.Call("echo", &testCallStruct{}, &testCallStruct{}); err != nil {
+		t.Fatalf("Call() failed: %s", err)
+	}
+	if attempts != 4 {
+		t.Fatalf("Expected 4 attempts but got %d", attempts)
+	}
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond}
+	for i, d := range expected {
+		if sleeps[i] != d {
+			t.Errorf("Expected backoff %s before retry %d but got %s", d, i+1, sleeps[i])
+		}
+	}
+}
+
+func TestRetryClientMiddlewareNotRetryable(t *testing.T) {
+	errs := []error{
+		NewTApplicationException(INTERNAL_ERROR, "boom"),
+		NewTTransportException(TIMED_OUT, "timed out"),
+		NewTTransportException(END_OF_FILE, "eof"),
+	}
+	for _, callErr := range errs {
+		attempts := 0
+		client := WrapClient(TClientFunc(func(method string, args, result TStruct) error {
+			attempts++
+			return callErr
+		}), newRetryClientMiddleware(DefaultRetryPolicy, func(time.Duration) {}))
+		if err := client.Call("echo", &testCallStruct{}, &testCallStruct{}); err != callErr {
+			t.Fatalf("Expected error %v from Call() but got %v", callErr, err)
+		}
+		if attempts != 1 {
+			t.Fatalf("%v: expected 1 attempt but got %d", callErr, attempts)
+		}
+	}
+}
+
+func TestRetryClientMiddlewareRetryableTypes(t *testing.T) {
+	attempts := 0
+	policy := RetryPolicy{MaxAttempts: 2, RetryableTypes: []int{TIMED_OUT}}
+	client := WrapClient(TClientFunc(func(method string, args, result TStruct) error {
+		attempts++
+		if attempts == 1 {
+			return NewTTransportException(TIMED_OUT, "timed out")
+		}
+		return nil
+	}), newRetryClientMiddleware(policy, func(time.Duration) {}))
+	if err := client.Call("echo", &testCallStruct{}, &testCallStruct{}); err != nil {
+		t.Fatalf("Call() failed: %s", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("Expected 2 attempts but got %d", attempts)
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+	metrics := NewClientMetrics()
+	client := WrapClient(TClientFunc(func(method string, args, result TStruct) error {
+		if method == "fail" {
+			return errors.New("boom")
+		}
+		return nil
+	}), metrics.Middleware())
+	client.Call("echo", &testCallStruct{}, &testCallStruct{})
+	client.Call("echo", &testCallStruct{}, &testCallStruct{})
+	client.Call("fail", &testCallStruct{}, &testCallStruct{})
+	if s := metrics.Stats("echo"); s.Calls != 2 || s.Errors != 0 {
+		t.Errorf("Unexpected stats for echo: %+v", s)
+	}
+	if s := metrics.Stats("fail"); s.Calls != 1 || s.Errors != 1 {
+		t.Errorf("Unexpected stats for fail: %+v", s)
+	}
+	if len(metrics.Snapshot()) != 2 {
+		t.Errorf("Expected 2 methods in snapshot")
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"testing"
+)
+
+// Minimal struct with a single i32 field, used as args and result in the
+// client and processor tests.
+type testCallStruct struct {
+	Value int32
+}
+
+func (p *testCallStruct) Write(oprot TProtocol) error {
+	if err := oprot.WriteStructBegin("testCallStruct"); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldBegin("value", I32, 1); err != nil {
+		return err
+	}
+	if err := oprot.WriteI32(p.Value); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return err
+	}
+	return oprot.WriteStructEnd()
+}
+
+func (p *testCallStruct) Read(iprot TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return err
+	}
+	for {
+		_, typeId, id, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if typeId == STOP {
+			break
+		}
+		if id == 1 && typeId == I32 {
+			if p.Value, err = iprot.ReadI32(); err != nil {
+				return err
+			}
+		} else if err = iprot.Skip(typeId); err != nil {
+			return err
+		}
+		if err = iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	return iprot.ReadStructEnd()
+}
+
+type testWritable interface {
+	Write(oprot TProtocol) error
+}
+
+func writeTestReply(t *testing.T, oprot TProtocol, method string, typeId TMessageType, seqId int32, body testWritable) {
+	if err := oprot.WriteMessageBegin(method, typeId, seqId); err != nil {
+		t.Fatalf("WriteMessageBegin() failed: %s", err)
+	}
+	if err := body.Write(oprot); err != nil {
+		t.Fatalf("Write() failed: %s", err)
+	}
+	if err := oprot.WriteMessageEnd(); err != nil {
+		t.Fatalf("WriteMessageEnd() failed: %s", err)
+	}
+}
+
+func TestStandardClientCall(t *testing.T) {
+	in := NewTMemoryBuffer()
+	out := NewTMemoryBuffer()
+	iprot := NewTBinaryProtocolTransport(in)
+	oprot := NewTBinaryProtocolTransport(out)
+	writeTestReply(t, NewTBinaryProtocolTransport(in), "echo", REPLY, 1, &testCallStruct{42})
+
+	client := NewTStandardClient(iprot, oprot)
+	result := &testCallStruct{}
+	if err := client.Call("echo", &testCallStruct{42}, result); err != nil {
+		t.Fatalf("Call() failed: %s", err)
+	}
+	if result.Value != 42 {
+		t.Fatalf("Expected result 42 but got %d", result.Value)
+	}
+
+	name, typeId, seqId, err := NewTBinaryProtocolTransport(out).ReadMessageBegin()
+	if err != nil {
+		t.Fatalf("ReadMessageBegin() failed: %s", err)
+	}
+	if name != "echo" || typeId != CALL || seqId != 1 {
+		t.Fatalf("Unexpected request header %q %d %d", name, typeId, seqId)
+	}
+}
+
+func TestStandardClientOneway(t *testing.T) {
+	out := NewTMemoryBuffer()
+	client := NewTStandardClient(NewTBinaryProtocolTransport(NewTMemoryBuffer()), NewTBinaryProtocolTransport(out))
+	if err := client.Call("notify", &testCallStruct{1}, nil); err != nil {
+		t.Fatalf("Call() failed: %s", err)
+	}
+	_, typeId, _, err := NewTBinaryProtocolTransport(out).ReadMessageBegin()
+	if err != nil {
+		t.Fatalf("ReadMessageBegin() failed: %s", err)
+	}
+	if typeId != ONEWAY {
+		t.Fatalf("Expected ONEWAY message type but got %d", typeId)
+	}
+}
+
+func TestStandardClientErrors(t *testing.T) {
+	tests := []struct {
+		method string
+		typeId TMessageType
+		seqId  int32
+		body   testWritable
+		expect int32
+	}{
+		{"echo", EXCEPTION, 1, NewTApplicationException(INTERNAL_ERROR, "boom"), INTERNAL_ERROR},
+		{"other", REPLY, 1, &testCallStruct{}, WRONG_METHOD_NAME},
+		{"echo", REPLY, 7, &testCallStruct{}, BAD_SEQUENCE_ID},
+		{"echo", CALL, 1, &testCallStruct{}, INVALID_MESSAGE_TYPE_EXCEPTION},
+	}
+	for _, test := range tests {
+		in := NewTMemoryBuffer()
+		writeTestReply(t, NewTBinaryProtocolTransport(in), test.method, test.typeId, test.seqId, test.body)
+		client := NewTStandardClient(NewTBinaryProtocolTransport(in), NewTBinaryProtocolTransport(NewTMemoryBuffer()))
+		err := client.Call("echo", &testCallStruct{}, &testCallStruct{})
+		e, ok := err.(TApplicationException)
+		if !ok {
+			t.Fatalf("Expected TApplicationException but got %v", err)
+		}
+		if e.TypeId() != test.expect {
+			t.Errorf("Expected exception type %d but got %d (%s)", test.expect, e.TypeId(), e)
+		}
+		if in.Len() != 0 {
+			t.Errorf("Expected the reply to be read to its end, %d bytes left (%s)", in.Len(), e)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Command thrift-introspect asks a server for the services it exposes, using
+// the introspection service registered on its TMultiplexedProcessor.
+//
+//	thrift-introspect -h localhost:9090 -framed -P compact
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"git.apache.org/thrift.git/lib/go/thrift"
+)
+
+func Usage() {
+	fmt.Fprintln(os.Stderr, "Usage of ", os.Args[0], " [-h host:port] [-u url] [-framed] [-P protocol] [-service name] [-json]:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	var host string
+	var port int
+	var protocol string
+	var urlString string
+	var framed bool
+	var useHttp bool
+	var service string
+	var asJSON bool
+	var timeout time.Duration
+	flag.Usage = Usage
+	flag.StringVar(&host, "h", "localhost", "Specify host and port")
+	flag.IntVar(&port, "p", 9090, "Specify port")
+	flag.StringVar(&protocol, "P", "binary", "Specify the protocol (binary, compact, json)")
+	flag.StringVar(&urlString, "u", "", "Specify the url")
+	flag.BoolVar(&framed, "framed", false, "Use framed transport")
+	flag.BoolVar(&useHttp, "http", false, "Use http")
+	flag.StringVar(&service, "service", thrift.INTROSPECTION_SERVICE_NAME, "Specify the name of the introspection service")
+	flag.BoolVar(&asJSON, "json", false, "Print the description as JSON")
+	flag.DurationVar(&timeout, "timeout", 10*time.Second, "Specify the connect and read timeout")
+	flag.Parse()
+
+	if useHttp && len(urlString) == 0 {
+		urlString = fmt.Sprint("http://", net.JoinHostPort(host, fmt.Sprint(port)), "/")
+	}
+
+	var trans thrift.TTransport
+	var err error
+	if len(urlString) > 0 {
+		trans, err = thrift.NewTHttpClientWithOptions(urlString, thrift.THttpClientOptions{
+			ConnectTimeout: timeout,
+			ReadTimeout:    timeout,
+		})
+	} else {
+		portStr := fmt.Sprint(port)
+		if strings.Contains(host, ":") {
+			host, portStr, err = net.SplitHostPort(host)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error with host:", err)
+				os.Exit(1)
+			}
+		}
+		trans, err = thrift.NewTSocketTimeout(net.JoinHostPort(host, portStr), timeout)
+		if err == nil && framed {
+			trans = thrift.NewTFramedTransport(trans)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error creating transport", err)
+		os.Exit(1)
+	}
+	defer trans.Close()
+
+	var protocolFactory thrift.TProtocolFactory
+	switch protocol {
+	case "compact":
+		protocolFactory = thrift.NewTCompactProtocolFactory()
+	case "json":
+		protocolFactory = thrift.NewTJSONProtocolFactory()
+	case "binary", "":
+		protocolFactory = thrift.NewTBinaryProtocolFactoryDefault()
+	default:
+		fmt.Fprintln(os.Stderr, "Invalid protocol specified: ", protocol)
+		Usage()
+		os.Exit(2)
+	}
+	if err := trans.Open(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening transport", err)
+		os.Exit(1)
+	}
+
+	conn := thrift.NewTMultiplexedConnection(trans, protocolFactory)
+	info, err := thrift.NewTIntrospectionClient(conn.Client(service)).Describe()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error calling describe:", err)
+		os.Exit(1)
+	}
+
+	if asJSON {
+		b, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error encoding description:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(b))
+		return
+	}
+	printServerInfo(info)
+}
+
+func printServerInfo(info *thrift.TServerInfo) {
+	started := time.Unix(0, info.StartTime*int64(time.Millisecond))
+	uptime := time.Duration(info.UptimeMillis) * time.Millisecond
+	fmt.Println("Version:         ", info.Version)
+	fmt.Println("Library version: ", info.LibraryVersion)
+	fmt.Println("Started:         ", started.Format(time.RFC3339), "(up", uptime.String()+")")
+	if info.ServerTransport != "" {
+		fmt.Println("Server transport:", info.ServerTransport)
+		fmt.Println("Transports:      ", info.InputTransportFactory, "in,", info.OutputTransportFactory, "out")
+		fmt.Println("Protocols:       ", info.InputProtocolFactory, "in,", info.OutputProtocolFactory, "out")
+	}
+	fmt.Println("Services:")
+	for _, service := range info.Services {
+		fmt.Println("  " + service.Name)
+		for _, method := range service.Methods {
+			fmt.Println("    " + method)
+		}
+	}
+}
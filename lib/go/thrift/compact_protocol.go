@@ -319,7 +319,7 @@ func (p *TCompactProtocol) ReadMessageBegin() (name string, typeId TMessageType,
 	}
 	versionAndType, err := p.ReadByte()
 	version := versionAndType & COMPACT_VERSION_MASK
-	typeId = TMessageType((versionAndType >> COMPACT_TYPE_SHIFT_AMOUNT) & 0x03)
+	typeId = TMessageType((versionAndType & COMPACT_TYPE_MASK) >> COMPACT_TYPE_SHIFT_AMOUNT)
 	if err != nil {
 		return
 	}
@@ -410,6 +410,9 @@ func (p *TCompactProtocol) ReadMapBegin() (keyType TType, valueType TType, size
 		err = NewTProtocolException(e)
 		return
 	}
+	if e := checkReadSize(size, MaxContainerSize, remainingBytes(p.trans)); e != nil {
+		return keyType, valueType, 0, e
+	}
 	keyAndValueType := byte(STOP)
 	if size != 0 {
 		keyAndValueType, err = p.ReadByte()
@@ -441,6 +444,9 @@ func (p *TCompactProtocol) ReadListBegin() (elemType TType, size int, err error)
 			return
 		}
 		size = int(size2)
+		if e := checkReadSize(size, MaxContainerSize, remainingBytes(p.trans)); e != nil {
+			return elemType, 0, e
+		}
 	}
 	elemType, e := p.getTType(tCompactType(size_and_type))
 	if e != nil {
@@ -535,9 +541,11 @@ func (p *TCompactProtocol) ReadBinary() (value []byte, err error) {
 	if length == 0 {
 		return []byte{}, nil
 	}
+	if e := checkReadSize(int(length), MaxStringSize, remainingBytes(p.trans)); e != nil {
+		return nil, e
+	}
 
-	buf := make([]byte, length)
-	_, e = io.ReadFull(p.trans, buf)
+	buf, e := readSizedBytes(p.trans, int(length))
 	return buf, NewTProtocolException(e)
 }
 
@@ -672,6 +680,9 @@ func (p *TCompactProtocol) readVarint64() (int64, error) {
 			break
 		}
 		shift += 7
+		if shift >= 70 {
+			return 0, NewTProtocolExceptionWithType(INVALID_DATA, fmt.Errorf("Varint longer than 10 bytes"))
+		}
 	}
 	return result, nil
 }
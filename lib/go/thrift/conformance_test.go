@@ -0,0 +1,505 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The conformance vectors in testdata/conformance hold the encodings that
+// the Java and C++ libraries produce for ThriftTest-style structs and
+// messages. Each file is named <case>.<encoding>; binary encodings are
+// stored as hex dumps with '#' comments, JSON encodings as text.
+
+// goldenStruct describes a struct by its fields in wire order. Values are
+// bool, int8, int16, int32, int64, float64, string, []byte, goldenStruct,
+// *goldenList or *goldenMap.
+type goldenStruct []goldenField
+
+type goldenField struct {
+	Id    int16
+	Type  TType
+	Value interface{}
+}
+
+// A list or a set, depending on the type of the enclosing field or container.
+type goldenList struct {
+	Elem   TType
+	Values []interface{}
+}
+
+type goldenMap struct {
+	Key, Value   TType
+	Keys, Values []interface{}
+}
+
+type goldenMessage struct {
+	Name  string
+	Type  TMessageType
+	SeqId int32
+	Body  goldenStruct
+}
+
+var goldenXtruct = goldenStruct{
+	{1, STRING, "Zero"},
+	{4, BYTE, int8(1)},
+	{9, I32, int32(-3)},
+	{11, I64, int64(-5)},
+}
+
+var conformanceStructs = map[string]goldenStruct{
+	"xtruct": goldenXtruct,
+	"xtruct2": {
+		{1, BYTE, int8(1)},
+		{2, STRUCT, goldenXtruct},
+		{3, I32, int32(5)},
+	},
+	"bools": {
+		{1, BOOL, true},
+		{2, BOOL, false},
+		{3, LIST, &goldenList{BOOL, []interface{}{true, false, true}}},
+		{20, BOOL, true},
+	},
+	"numbers": {
+		{1, BYTE, int8(-128)},
+		{2, I16, int16(-32768)},
+		{3, I32, int32(2147483647)},
+		{4, I64, int64(-9223372036854775808)},
+		{5, DOUBLE, 3.5},
+		{6, DOUBLE, -0.25},
+		{7, I64, int64(1234567890123)},
+		{8, DOUBLE, math.Inf(1)},
+		{9, DOUBLE, math.Inf(-1)},
+	},
+	"strings": {
+		{1, STRING, "Tab\tQuote\"Backslash\\Slash/<&>"},
+		{2, STRING, "Grüße ☃"},
+		{3, STRING, []byte{0x00, 0x01, 0xff, 0x80}},
+		{4, STRING, []byte{0x01}},
+		{5, STRING, []byte{}},
+		{6, STRING, ""},
+		{7, STRING, "\x01\x1f\n"},
+	},
+	"containers": {
+		{1, LIST, &goldenList{I32, []interface{}{int32(1), int32(2), int32(3)}}},
+		{2, SET, &goldenList{STRING, []interface{}{"a", "b"}}},
+		{3, MAP, &goldenMap{I32, STRING, []interface{}{int32(1), int32(2)}, []interface{}{"one", "two"}}},
+		{4, MAP, &goldenMap{STRING, LIST, []interface{}{}, []interface{}{}}},
+		{5, LIST, &goldenList{BYTE, []interface{}{int8(0), int8(1), int8(2), int8(3), int8(4), int8(5), int8(6), int8(7), int8(8), int8(9), int8(10), int8(11), int8(12), int8(13), int8(14)}}},
+		{6, LIST, &goldenList{STRUCT, []interface{}{goldenStruct{{1, STRING, "a"}, {9, I32, int32(7)}}}}},
+		{7, MAP, &goldenMap{STRING, MAP, []interface{}{"x"}, []interface{}{&goldenMap{I32, BOOL, []interface{}{int32(1)}, []interface{}{true}}}}},
+	},
+	"field-ids": {
+		{1, I16, int16(1)},
+		{16, I16, int16(2)},
+		{40, I16, int16(3)},
+		{2, I16, int16(4)},
+		{300, I16, int16(5)},
+	},
+	// Only read, as the implementations format these numbers differently.
+	"doubles": {
+		{1, DOUBLE, 1e100},
+		{2, DOUBLE, -1.5e-7},
+		{3, DOUBLE, 100.0},
+	},
+}
+
+var conformanceMessages = map[string]goldenMessage{
+	"call":      {"testStruct", CALL, 1, goldenStruct{{1, STRUCT, goldenXtruct}}},
+	"reply":     {"testStruct", REPLY, 1, goldenStruct{{0, STRUCT, goldenXtruct}}},
+	"exception": {"testMissing", EXCEPTION, 2147483647, goldenStruct{{1, STRING, "Unknown function testMissing"}, {2, I32, int32(UNKNOWN_METHOD)}}},
+	"oneway":    {"testOneway", ONEWAY, 3, goldenStruct{{1, I32, int32(1)}}},
+	"void":      {"testVoid", CALL, 42, goldenStruct{}},
+}
+
+// Vectors in alternative encodings that Go must read but does not write.
+var conformanceReadOnly = map[string]string{
+	"bools-legacy":   "bools",
+	"strings-padded": "strings",
+	"doubles-java":   "doubles",
+	"doubles-cpp":    "doubles",
+}
+
+var conformanceProtocols = map[string]func(TTransport) TProtocol{
+	"binary": func(t TTransport) TProtocol {
+		return NewTBinaryProtocol(t, true, true)
+	},
+	"binary-nonstrict": func(t TTransport) TProtocol {
+		return NewTBinaryProtocol(t, false, false)
+	},
+	"compact": func(t TTransport) TProtocol {
+		return NewTCompactProtocol(t)
+	},
+	"json": func(t TTransport) TProtocol {
+		return NewTJSONProtocol(t)
+	},
+}
+
+func (s goldenStruct) write(p TProtocol) error {
+	if err := p.WriteStructBegin("golden"); err != nil {
+		return err
+	}
+	for _, f := range s {
+		if err := p.WriteFieldBegin(fmt.Sprint("field", f.Id), f.Type, f.Id); err != nil {
+			return err
+		}
+		if err := writeGoldenValue(p, f.Type, f.Value); err != nil {
+			return err
+		}
+		if err := p.WriteFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := p.WriteFieldStop(); err != nil {
+		return err
+	}
+	return p.WriteStructEnd()
+}
+
+func writeGoldenValue(p TProtocol, t TType, value interface{}) error {
+	switch v := value.(type) {
+	case bool:
+		return p.WriteBool(v)
+	case int8:
+		return p.WriteByte(byte(v))
+	case int16:
+		return p.WriteI16(v)
+	case int32:
+		return p.WriteI32(v)
+	case int64:
+		return p.WriteI64(v)
+	case float64:
+		return p.WriteDouble(v)
+	case string:
+		return p.WriteString(v)
+	case []byte:
+		return p.WriteBinary(v)
+	case goldenStruct:
+		return v.write(p)
+	case *goldenList:
+		var err error
+		if t == SET {
+			err = p.WriteSetBegin(v.Elem, len(v.Values))
+		} else {
+			err = p.WriteListBegin(v.Elem, len(v.Values))
+		}
+		if err != nil {
+			return err
+		}
+		for _, e := range v.Values {
+			if err := writeGoldenValue(p, v.Elem, e); err != nil {
+				return err
+			}
+		}
+		if t == SET {
+			return p.WriteSetEnd()
+		}
+		return p.WriteListEnd()
+	case *goldenMap:
+		if err := p.WriteMapBegin(v.Key, v.Value, len(v.Keys)); err != nil {
+			return err
+		}
+		for i := range v.Keys {
+			if err := writeGoldenValue(p, v.Key, v.Keys[i]); err != nil {
+				return err
+			}
+			if err := writeGoldenValue(p, v.Value, v.Values[i]); err != nil {
+				return err
+			}
+		}
+		return p.WriteMapEnd()
+	}
+	return fmt.Errorf("unsupported golden value %T", value)
+}
+
+// Reads a struct using want as its schema, like generated code would, and
+// returns what was on the wire.
+func readGoldenStruct(p TProtocol, want goldenStruct) (goldenStruct, error) {
+	if _, err := p.ReadStructBegin(); err != nil {
+		return nil, err
+	}
+	got := goldenStruct{}
+	for {
+		_, typeId, id, err := p.ReadFieldBegin()
+		if err != nil {
+			return nil, err
+		}
+		if typeId == STOP {
+			break
+		}
+		var field *goldenField
+		for i := range want {
+			if want[i].Id == id {
+				field = &want[i]
+			}
+		}
+		if field == nil {
+			return nil, fmt.Errorf("unexpected field %d", id)
+		}
+		if typeId != field.Type {
+			return nil, fmt.Errorf("field %d has type %s, want %s", id, typeId, field.Type)
+		}
+		value, err := readGoldenValue(p, typeId, field.Value)
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %s", id, err)
+		}
+		got = append(got, goldenField{id, typeId, value})
+		if err := p.ReadFieldEnd(); err != nil {
+			return nil, err
+		}
+	}
+	return got, p.ReadStructEnd()
+}
+
+func readGoldenValue(p TProtocol, t TType, want interface{}) (interface{}, error) {
+	switch w := want.(type) {
+	case bool:
+		return p.ReadBool()
+	case int8:
+		v, err := p.ReadByte()
+		return int8(v), err
+	case int16:
+		return p.ReadI16()
+	case int32:
+		return p.ReadI32()
+	case int64:
+		return p.ReadI64()
+	case float64:
+		return p.ReadDouble()
+	case string:
+		return p.ReadString()
+	case []byte:
+		v, err := p.ReadBinary()
+		if v == nil {
+			v = []byte{}
+		}
+		return v, err
+	case goldenStruct:
+		return readGoldenStruct(p, w)
+	case *goldenList:
+		var elem TType
+		var size int
+		var err error
+		if t == SET {
+			elem, size, err = p.ReadSetBegin()
+		} else {
+			elem, size, err = p.ReadListBegin()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if elem != w.Elem || size != len(w.Values) {
+			return nil, fmt.Errorf("container of %d %s, want %d %s", size, elem, len(w.Values), w.Elem)
+		}
+		got := &goldenList{elem, []interface{}{}}
+		for _, e := range w.Values {
+			v, err := readGoldenValue(p, elem, e)
+			if err != nil {
+				return nil, err
+			}
+			got.Values = append(got.Values, v)
+		}
+		if t == SET {
+			return got, p.ReadSetEnd()
+		}
+		return got, p.ReadListEnd()
+	case *goldenMap:
+		key, value, size, err := p.ReadMapBegin()
+		if err != nil {
+			return nil, err
+		}
+		if size != len(w.Keys) {
+			return nil, fmt.Errorf("map of %d elements, want %d", size, len(w.Keys))
+		}
+		// The compact protocol omits the types of empty maps.
+		if size > 0 && (key != w.Key || value != w.Value) {
+			return nil, fmt.Errorf("map<%s,%s>, want map<%s,%s>", key, value, w.Key, w.Value)
+		}
+		got := &goldenMap{w.Key, w.Value, []interface{}{}, []interface{}{}}
+		for i := range w.Keys {
+			k, err := readGoldenValue(p, w.Key, w.Keys[i])
+			if err != nil {
+				return nil, err
+			}
+			v, err := readGoldenValue(p, w.Value, w.Values[i])
+			if err != nil {
+				return nil, err
+			}
+			got.Keys = append(got.Keys, k)
+			got.Values = append(got.Values, v)
+		}
+		return got, p.ReadMapEnd()
+	}
+	return nil, fmt.Errorf("unsupported golden value %T", want)
+}
+
+// Loads a vector, decoding hex dumps of the binary encodings.
+func readConformanceVector(t testing.TB, path string) []byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(path) == ".json" {
+		return bytes.TrimSuffix(data, []byte("\n"))
+	}
+	var vector []byte
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		b, err := hex.DecodeString(strings.Join(strings.Fields(line), ""))
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		vector = append(vector, b...)
+	}
+	return vector
+}
+
+type conformanceVector struct {
+	name, encoding string
+	readOnly       bool
+	data           []byte
+}
+
+func conformanceVectors(t *testing.T) []conformanceVector {
+	paths, err := filepath.Glob(filepath.Join("testdata", "conformance", "*.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no conformance vectors found")
+	}
+	var vectors []conformanceVector
+	for _, path := range paths {
+		base := filepath.Base(path)
+		if base == "README" {
+			continue
+		}
+		ext := filepath.Ext(base)
+		v := conformanceVector{name: strings.TrimSuffix(base, ext), encoding: ext[1:]}
+		if _, ok := conformanceProtocols[v.encoding]; !ok {
+			t.Fatalf("%s: unknown encoding %q", path, v.encoding)
+		}
+		if name, ok := conformanceReadOnly[v.name]; ok {
+			v.name, v.readOnly = name, true
+		}
+		_, isStruct := conformanceStructs[v.name]
+		_, isMessage := conformanceMessages[v.name]
+		if !isStruct && !isMessage {
+			t.Fatalf("%s: unknown case %q", path, v.name)
+		}
+		if isStruct && v.name == "doubles" {
+			v.readOnly = true
+		}
+		v.data = readConformanceVector(t, path)
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+func (v conformanceVector) String() string {
+	return v.name + "." + v.encoding
+}
+
+func (v conformanceVector) format(data []byte) string {
+	if v.encoding == "json" {
+		return string(data)
+	}
+	return hex.EncodeToString(data)
+}
+
+func TestConformanceRead(t *testing.T) {
+	for _, v := range conformanceVectors(t) {
+		trans := NewTMemoryBuffer()
+		trans.Write(v.data)
+		p := conformanceProtocols[v.encoding](trans)
+		if want, ok := conformanceMessages[v.name]; ok {
+			name, typeId, seqId, err := p.ReadMessageBegin()
+			if err != nil {
+				t.Errorf("%s: ReadMessageBegin: %s", v, err)
+				continue
+			}
+			body, err := readGoldenStruct(p, want.Body)
+			if err == nil {
+				err = p.ReadMessageEnd()
+			}
+			if err != nil {
+				t.Errorf("%s: %s", v, err)
+				continue
+			}
+			got := goldenMessage{name, typeId, seqId, body}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: read %#v, want %#v", v, got, want)
+			}
+		} else {
+			want := conformanceStructs[v.name]
+			got, err := readGoldenStruct(p, want)
+			if err != nil {
+				t.Errorf("%s: %s", v, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: read %#v, want %#v", v, got, want)
+			}
+		}
+		if v.encoding != "json" && trans.Len() != 0 {
+			t.Errorf("%s: %d trailing bytes not read", v, trans.Len())
+		}
+	}
+}
+
+func TestConformanceWrite(t *testing.T) {
+	for _, v := range conformanceVectors(t) {
+		if v.readOnly {
+			continue
+		}
+		trans := NewTMemoryBuffer()
+		p := conformanceProtocols[v.encoding](trans)
+		var err error
+		if m, ok := conformanceMessages[v.name]; ok {
+			if err = p.WriteMessageBegin(m.Name, m.Type, m.SeqId); err == nil {
+				if err = m.Body.write(p); err == nil {
+					err = p.WriteMessageEnd()
+				}
+			}
+		} else {
+			err = conformanceStructs[v.name].write(p)
+		}
+		if err == nil {
+			err = p.Flush()
+		}
+		if err != nil {
+			t.Errorf("%s: %s", v, err)
+			continue
+		}
+		if !bytes.Equal(trans.Bytes(), v.data) {
+			t.Errorf("%s: wrote\n%s\nwant\n%s", v, v.format(trans.Bytes()), v.format(v.data))
+		}
+	}
+}
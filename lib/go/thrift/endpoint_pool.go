@@ -0,0 +1,511 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_ENDPOINT_ERROR_WINDOW          = 20
+	DEFAULT_ENDPOINT_EJECTION_TIME         = 30 * time.Second
+	DEFAULT_ENDPOINT_HEALTH_CHECK_INTERVAL = 10 * time.Second
+	DEFAULT_ENDPOINT_RELOAD_INTERVAL       = 10 * time.Second
+)
+
+// How a TEndpointPool chooses the endpoint of a new connection.
+type TEndpointBalancing int
+
+const (
+	// Take the endpoints in turn.
+	ROUND_ROBIN TEndpointBalancing = iota
+	// Take the endpoint with the fewest requests awaiting a reply, then with
+	// the fewest connections.
+	LEAST_OUTSTANDING
+)
+
+type TEndpointPoolOptions struct {
+	Balancing TEndpointBalancing
+	// Creates the transport of a connection to hostPort. Defaults to a
+	// TSocket configured by SocketConf, which may be nil.
+	NewTransport func(hostPort string) (TTransport, error)
+	SocketConf   *TSocketConf
+	// Checked for every endpoint each HealthCheckInterval, if set. Endpoints
+	// failing it are ejected until they pass it again.
+	HealthCheck         func(hostPort string) error
+	HealthCheckInterval time.Duration
+	// Endpoints whose share of failed requests and connection attempts over
+	// the last ErrorWindow ones exceeds MaxErrorRate are ejected for
+	// EjectionTime. Zero disables ejection by error rate.
+	MaxErrorRate float64
+	ErrorWindow  int
+	EjectionTime time.Duration
+	// How often the file of NewTEndpointPoolFromFile is checked for changes.
+	ReloadInterval time.Duration
+	// Receives the errors of reloading the endpoint file.
+	Logger Logger
+}
+
+// The state of an endpoint, as reported by TEndpointPool.Endpoints.
+type TEndpointStatus struct {
+	HostPort    string
+	Outstanding int
+	Connections int
+	Ejected     bool
+	Healthy     bool
+}
+
+type tEndpoint struct {
+	hostPort     string
+	outstanding  int
+	connections  int
+	outcomes     tOutcomeWindow
+	ejectedUntil time.Time
+	unhealthy    bool
+}
+
+// The outcomes of the last requests, for computing an error rate.
+type tOutcomeWindow struct {
+	outcomes     []bool
+	next, errors int
+}
+
+// Records an outcome and returns the error rate once size outcomes have
+// been recorded, or 0.
+func (w *tOutcomeWindow) record(ok bool, size int) float64 {
+	if len(w.outcomes) < size {
+		w.outcomes = append(w.outcomes, ok)
+	} else {
+		if !w.outcomes[w.next] {
+			w.errors--
+		}
+		w.outcomes[w.next] = ok
+		w.next = (w.next + 1) % size
+	}
+	if !ok {
+		w.errors++
+	}
+	if len(w.outcomes) < size {
+		return 0
+	}
+	return float64(w.errors) / float64(size)
+}
+
+func (w *tOutcomeWindow) reset() {
+	w.outcomes, w.next, w.errors = nil, 0, 0
+}
+
+func (e *tEndpoint) available(now time.Time) bool {
+	return !e.unhealthy && !now.Before(e.ejectedUntil)
+}
+
+// TEndpointPool is a set of equivalent server endpoints shared by the client
+// connections to them. Its Transport method returns a TTransport that
+// connects to one of them when opened. The set is either static, possibly
+// changed with SetEndpoints, or read from a file.
+type TEndpointPool struct {
+	mu        sync.Mutex
+	options   TEndpointPoolOptions
+	endpoints []*tEndpoint
+	next      int
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewTEndpointPool creates a pool of the given "host:port" endpoints. The
+// health checks, if any, run until Close is called.
+func NewTEndpointPool(endpoints []string, options TEndpointPoolOptions) *TEndpointPool {
+	if options.ErrorWindow <= 0 {
+		options.ErrorWindow = DEFAULT_ENDPOINT_ERROR_WINDOW
+	}
+	if options.EjectionTime <= 0 {
+		options.EjectionTime = DEFAULT_ENDPOINT_EJECTION_TIME
+	}
+	if options.HealthCheckInterval <= 0 {
+		options.HealthCheckInterval = DEFAULT_ENDPOINT_HEALTH_CHECK_INTERVAL
+	}
+	if options.ReloadInterval <= 0 {
+		options.ReloadInterval = DEFAULT_ENDPOINT_RELOAD_INTERVAL
+	}
+	if options.Logger == nil {
+		options.Logger = StdLogger(nil)
+	}
+	p := &TEndpointPool{options: options, done: make(chan struct{})}
+	p.SetEndpoints(endpoints)
+	if options.HealthCheck != nil {
+		p.every(options.HealthCheckInterval, p.checkHealth)
+	}
+	return p
+}
+
+// NewTEndpointPoolFromFile creates a pool of the endpoints listed in the file
+// at path, one "host:port" per line. Blank lines and lines starting with #
+// are ignored. The file is read again whenever it changes, until Close is
+// called; if it cannot be read, the current endpoints are kept.
+func NewTEndpointPoolFromFile(path string, options TEndpointPoolOptions) (*TEndpointPool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := readEndpointFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := NewTEndpointPool(endpoints, options)
+	modTime := info.ModTime()
+	p.every(p.options.ReloadInterval, func() {
+		info, err := os.Stat(path)
+		if err != nil {
+			p.options.Logger(fmt.Sprint("error checking endpoint file: ", err))
+			return
+		}
+		if info.ModTime().Equal(modTime) {
+			return
+		}
+		endpoints, err := readEndpointFile(path)
+		if err != nil {
+			p.options.Logger(fmt.Sprint("error reading endpoint file: ", err))
+			return
+		}
+		modTime = info.ModTime()
+		p.SetEndpoints(endpoints)
+	})
+	return p, nil
+}
+
+func readEndpointFile(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(line); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		endpoints = append(endpoints, line)
+	}
+	return endpoints, scanner.Err()
+}
+
+// Runs f every interval on its own goroutine until Close is called.
+func (p *TEndpointPool) every(interval time.Duration, f func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				f()
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+// Replaces the endpoints. Endpoints that remain keep their state, and
+// connections to removed ones stay open until they are closed.
+func (p *TEndpointPool) SetEndpoints(endpoints []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	existing := make(map[string]*tEndpoint, len(p.endpoints))
+	for _, e := range p.endpoints {
+		existing[e.hostPort] = e
+	}
+	p.endpoints = make([]*tEndpoint, 0, len(endpoints))
+	for _, hostPort := range endpoints {
+		e, ok := existing[hostPort]
+		if !ok {
+			e = &tEndpoint{hostPort: hostPort}
+		}
+		delete(existing, hostPort)
+		p.endpoints = append(p.endpoints, e)
+	}
+}
+
+// Returns the state of the endpoints, in the order they were given.
+func (p *TEndpointPool) Endpoints() []TEndpointStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	status := make([]TEndpointStatus, len(p.endpoints))
+	for i, e := range p.endpoints {
+		status[i] = TEndpointStatus{
+			HostPort:    e.hostPort,
+			Outstanding: e.outstanding,
+			Connections: e.connections,
+			Ejected:     !e.available(now),
+			Healthy:     !e.unhealthy,
+		}
+	}
+	return status
+}
+
+// Stops the health checks and the reloading of the endpoint file. Open
+// connections are not affected.
+func (p *TEndpointPool) Close() error {
+	p.mu.Lock()
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return nil
+}
+
+// Returns a new, unopened transport connecting to the endpoints of p.
+func (p *TEndpointPool) Transport() *TMultiEndpointTransport {
+	return &TMultiEndpointTransport{pool: p}
+}
+
+// Returns the endpoints to try for a new connection, best first. If all of
+// them are ejected, they are all tried rather than none.
+func (p *TEndpointPool) candidates() []*tEndpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	var candidates []*tEndpoint
+	for _, e := range p.endpoints {
+		if e.available(now) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = append(candidates, p.endpoints...)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	start := p.next % len(candidates)
+	p.next++
+	ordered := make([]*tEndpoint, 0, len(candidates))
+	candidates = append(append(ordered, candidates[start:]...), candidates[:start]...)
+	if p.options.Balancing == LEAST_OUTSTANDING {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].outstanding != candidates[j].outstanding {
+				return candidates[i].outstanding < candidates[j].outstanding
+			}
+			return candidates[i].connections < candidates[j].connections
+		})
+	}
+	return candidates
+}
+
+func (p *TEndpointPool) newTransport(hostPort string) (TTransport, error) {
+	if p.options.NewTransport != nil {
+		return p.options.NewTransport(hostPort)
+	}
+	return NewTSocketConf(hostPort, p.options.SocketConf)
+}
+
+// Records the outcome of a request or connection attempt to e, ejecting it
+// if its error rate is too high.
+func (p *TEndpointPool) record(e *tEndpoint, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.options.MaxErrorRate <= 0 {
+		return
+	}
+	if e.outcomes.record(ok, p.options.ErrorWindow) > p.options.MaxErrorRate {
+		e.ejectedUntil = time.Now().Add(p.options.EjectionTime)
+		e.outcomes.reset()
+	}
+}
+
+// Adjusts the counters of e.
+func (p *TEndpointPool) count(e *tEndpoint, connections, outstanding int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e.connections += connections
+	e.outstanding += outstanding
+}
+
+func (p *TEndpointPool) checkHealth() {
+	p.mu.Lock()
+	endpoints := append([]*tEndpoint(nil), p.endpoints...)
+	p.mu.Unlock()
+	for _, e := range endpoints {
+		err := p.options.HealthCheck(e.hostPort)
+		p.mu.Lock()
+		e.unhealthy = err != nil
+		p.mu.Unlock()
+	}
+}
+
+// NewTCPHealthCheck returns a health check for TEndpointPoolOptions that
+// succeeds if a TCP connection can be established within timeout.
+func NewTCPHealthCheck(timeout time.Duration) func(hostPort string) error {
+	return func(hostPort string) error {
+		conn, err := net.DialTimeout("tcp", hostPort, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// TMultiEndpointTransport is a client connection to one of the endpoints of
+// a TEndpointPool, chosen when it is opened. If connecting fails, the other
+// endpoints are tried in turn. Wrapped in a TReconnectingTransport, a broken
+// connection is replaced by one to whichever endpoint is chosen then.
+//
+// A request is outstanding from the Flush that sends it until its reply
+// starts to arrive, the next request is written or the connection closes,
+// and counts as failed if the transport returns an error meanwhile. One
+// still outstanding when the connection closes is not counted, as it may
+// have been oneway or abandoned.
+type TMultiEndpointTransport struct {
+	pool     *TEndpointPool
+	trans    TTransport
+	endpoint *tEndpoint
+	pending  bool
+}
+
+// Returns the "host:port" of the current connection, or "" if not open.
+func (p *TMultiEndpointTransport) Endpoint() string {
+	if p.endpoint == nil {
+		return ""
+	}
+	return p.endpoint.hostPort
+}
+
+func (p *TMultiEndpointTransport) Open() error {
+	if p.trans != nil {
+		return NewTTransportException(ALREADY_OPEN, "Transport already open")
+	}
+	var lastErr error
+	for _, e := range p.pool.candidates() {
+		trans, err := p.pool.newTransport(e.hostPort)
+		if err == nil {
+			err = trans.Open()
+		}
+		if err != nil {
+			p.pool.record(e, false)
+			lastErr = err
+			continue
+		}
+		p.pool.count(e, 1, 0)
+		p.trans, p.endpoint = trans, e
+		return nil
+	}
+	if lastErr == nil {
+		return NewTTransportException(NOT_OPEN, "No endpoints")
+	}
+	return NewTTransportException(NOT_OPEN, "No endpoint available: "+lastErr.Error())
+}
+
+func (p *TMultiEndpointTransport) IsOpen() bool {
+	return p.trans != nil && p.trans.IsOpen()
+}
+
+func (p *TMultiEndpointTransport) Close() error {
+	if p.trans == nil {
+		return nil
+	}
+	if p.pending {
+		p.pending = false
+		p.pool.count(p.endpoint, 0, -1)
+	}
+	p.pool.count(p.endpoint, -1, 0)
+	err := p.trans.Close()
+	p.trans, p.endpoint = nil, nil
+	return err
+}
+
+func (p *TMultiEndpointTransport) Read(buf []byte) (int, error) {
+	if p.trans == nil {
+		return 0, NewTTransportException(NOT_OPEN, "Transport not open")
+	}
+	n, err := p.trans.Read(buf)
+	if err != nil {
+		p.failed()
+	} else if n > 0 {
+		p.finish(true)
+	}
+	return n, err
+}
+
+func (p *TMultiEndpointTransport) Write(buf []byte) (int, error) {
+	if p.trans == nil {
+		return 0, NewTTransportException(NOT_OPEN, "Transport not open")
+	}
+	p.finish(true)
+	n, err := p.trans.Write(buf)
+	if err != nil {
+		p.failed()
+	}
+	return n, err
+}
+
+func (p *TMultiEndpointTransport) Flush() error {
+	if p.trans == nil {
+		return NewTTransportException(NOT_OPEN, "Transport not open")
+	}
+	if err := p.trans.Flush(); err != nil {
+		p.failed()
+		return err
+	}
+	if !p.pending {
+		p.pending = true
+		p.pool.count(p.endpoint, 0, 1)
+	}
+	return nil
+}
+
+func (p *TMultiEndpointTransport) Peek() bool {
+	return p.trans != nil && p.trans.Peek()
+}
+
+// Ends the outstanding request, if any, with the given outcome.
+func (p *TMultiEndpointTransport) finish(ok bool) {
+	if p.pending {
+		p.pending = false
+		p.pool.count(p.endpoint, 0, -1)
+		p.pool.record(p.endpoint, ok)
+	}
+}
+
+// Records a failure, of the outstanding request if there is one.
+func (p *TMultiEndpointTransport) failed() {
+	if p.pending {
+		p.finish(false)
+	} else {
+		p.pool.record(p.endpoint, false)
+	}
+}
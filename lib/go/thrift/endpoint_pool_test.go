@@ -0,0 +1,232 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Listens on a free local port, holding accepted connections open until the
+// test ends, and returns the address.
+func newTestEndpoint(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return l.Addr().String()
+}
+
+// Returns a local address nobody listens on.
+func newTestDeadEndpoint(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	return l.Addr().String()
+}
+
+func openTestEndpoint(t *testing.T, pool *TEndpointPool) *TMultiEndpointTransport {
+	trans := pool.Transport()
+	if err := trans.Open(); err != nil {
+		t.Fatalf("Unable to open transport: %s", err)
+	}
+	t.Cleanup(func() { trans.Close() })
+	return trans
+}
+
+func waitTestEndpoints(t *testing.T, pool *TEndpointPool, cond func([]TEndpointStatus) bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(pool.Endpoints()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Unexpected endpoints %+v", pool.Endpoints())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEndpointPoolRoundRobinFailover(t *testing.T) {
+	a, dead, b := newTestEndpoint(t), newTestDeadEndpoint(t), newTestEndpoint(t)
+	pool := NewTEndpointPool([]string{a, dead, b}, TEndpointPoolOptions{})
+	defer pool.Close()
+	counts := map[string]int{}
+	for i := 0; i < 6; i++ {
+		counts[openTestEndpoint(t, pool).Endpoint()]++
+	}
+	if counts[a] != 2 || counts[b] != 4 || counts[dead] != 0 {
+		t.Fatalf("Unexpected connections per endpoint %v", counts)
+	}
+	status := pool.Endpoints()
+	if status[0].Connections != 2 || status[2].Connections != 4 {
+		t.Fatalf("Unexpected status %+v", status)
+	}
+
+	pool.SetEndpoints([]string{dead})
+	if err := pool.Transport().Open(); err == nil {
+		t.Fatal("Expected no endpoint to be available")
+	}
+}
+
+func TestEndpointPoolLeastOutstanding(t *testing.T) {
+	a, b := newTestEndpoint(t), newTestEndpoint(t)
+	pool := NewTEndpointPool([]string{a, b}, TEndpointPoolOptions{Balancing: LEAST_OUTSTANDING})
+	defer pool.Close()
+	first := openTestEndpoint(t, pool)
+	first.Write([]byte("request"))
+	if err := first.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// The endpoint of first has a request outstanding, the other one gets
+	// all new connections until it has more.
+	for i := 0; i < 2; i++ {
+		if trans := openTestEndpoint(t, pool); trans.Endpoint() == first.Endpoint() {
+			t.Fatalf("Connection %d went to the busy endpoint %s", i, trans.Endpoint())
+		}
+	}
+	if status := pool.Endpoints(); status[0].Outstanding+status[1].Outstanding != 1 {
+		t.Fatalf("Expected one outstanding request, got %+v", status)
+	}
+	first.Close()
+	if status := pool.Endpoints(); status[0].Outstanding+status[1].Outstanding != 0 {
+		t.Fatalf("Expected no outstanding request, got %+v", status)
+	}
+}
+
+func TestEndpointPoolErrorRateEjection(t *testing.T) {
+	dead, b := newTestDeadEndpoint(t), newTestEndpoint(t)
+	pool := NewTEndpointPool([]string{dead, b}, TEndpointPoolOptions{MaxErrorRate: 0.5, ErrorWindow: 1})
+	defer pool.Close()
+	if trans := openTestEndpoint(t, pool); trans.Endpoint() != b {
+		t.Fatalf("Expected failover to %s, got %s", b, trans.Endpoint())
+	}
+	if status := pool.Endpoints(); !status[0].Ejected || status[1].Ejected {
+		t.Fatalf("Expected only %s to be ejected, got %+v", dead, status)
+	}
+}
+
+// A request outstanding when the connection closes has no known outcome.
+func TestEndpointPoolCloseOutstanding(t *testing.T) {
+	a := newTestEndpoint(t)
+	pool := NewTEndpointPool([]string{a}, TEndpointPoolOptions{MaxErrorRate: 0.5, ErrorWindow: 1})
+	defer pool.Close()
+	trans := openTestEndpoint(t, pool)
+	trans.Write([]byte("request"))
+	if err := trans.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	trans.Close()
+	pool.mu.Lock()
+	outcomes := len(pool.endpoints[0].outcomes.outcomes)
+	pool.mu.Unlock()
+	if status := pool.Endpoints(); outcomes != 0 || status[0].Outstanding != 0 {
+		t.Fatalf("Expected no outcome and no outstanding request, got %d outcomes and %+v", outcomes, status)
+	}
+}
+
+func TestEndpointPoolHealthCheck(t *testing.T) {
+	a, b := newTestEndpoint(t), newTestEndpoint(t)
+	pool := NewTEndpointPool([]string{a, b}, TEndpointPoolOptions{
+		HealthCheck: func(hostPort string) error {
+			if hostPort == a {
+				return errors.New("unhealthy")
+			}
+			return NewTCPHealthCheck(time.Second)(hostPort)
+		},
+		HealthCheckInterval: 5 * time.Millisecond,
+	})
+	defer pool.Close()
+	waitTestEndpoints(t, pool, func(status []TEndpointStatus) bool {
+		return !status[0].Healthy && status[0].Ejected && status[1].Healthy
+	})
+	for i := 0; i < 3; i++ {
+		if trans := openTestEndpoint(t, pool); trans.Endpoint() != b {
+			t.Fatalf("Expected %s, got %s", b, trans.Endpoint())
+		}
+	}
+}
+
+func TestEndpointPoolFromFile(t *testing.T) {
+	a, b := newTestEndpoint(t), newTestEndpoint(t)
+	path := filepath.Join(t.TempDir(), "endpoints")
+	if err := ioutil.WriteFile(path, []byte("# servers\n"+a+"\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := NewTEndpointPoolFromFile(path, TEndpointPoolOptions{ReloadInterval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if trans := openTestEndpoint(t, pool); trans.Endpoint() != a {
+		t.Fatalf("Expected %s, got %s", a, trans.Endpoint())
+	}
+
+	if err := ioutil.WriteFile(path, []byte(b+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	waitTestEndpoints(t, pool, func(status []TEndpointStatus) bool {
+		return len(status) == 1 && status[0].HostPort == b
+	})
+
+	if _, err := NewTEndpointPoolFromFile(filepath.Join(t.TempDir(), "missing"), TEndpointPoolOptions{}); err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+}
+
+func TestEndpointPoolReconnect(t *testing.T) {
+	a, b := newTestEndpoint(t), newTestEndpoint(t)
+	pool := NewTEndpointPool([]string{a, b}, TEndpointPoolOptions{})
+	defer pool.Close()
+	endpoints := pool.Transport()
+	trans := NewTReconnectingTransport(endpoints, TReconnectOptions{})
+	if err := trans.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer trans.Close()
+	first := endpoints.Endpoint()
+	// Closing the connection underneath makes the next request reconnect,
+	// to the next endpoint.
+	endpoints.Close()
+	if _, err := trans.Write([]byte("request")); err != nil {
+		t.Fatalf("Write after reconnecting failed: %s", err)
+	}
+	if endpoints.Endpoint() == first || endpoints.Endpoint() == "" {
+		t.Fatalf("Expected a connection to the other endpoint, got %q", endpoints.Endpoint())
+	}
+}
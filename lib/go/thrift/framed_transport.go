@@ -22,31 +22,46 @@ package thrift
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 )
 
+// The default maximum size of a frame read by TFramedTransport.
+const DEFAULT_MAX_LENGTH = 16384000
+
 type TFramedTransport struct {
 	transport   TTransport
 	writeBuffer *bytes.Buffer
 	readBuffer  *bytes.Buffer
+	maxLength   int
 }
 
 type tFramedTransportFactory struct {
-	factory TTransportFactory
+	factory   TTransportFactory
+	maxLength int
 }
 
 func NewTFramedTransportFactory(factory TTransportFactory) TTransportFactory {
-	return &tFramedTransportFactory{factory: factory}
+	return NewTFramedTransportFactoryMaxLength(factory, DEFAULT_MAX_LENGTH)
+}
+
+func NewTFramedTransportFactoryMaxLength(factory TTransportFactory, maxLength int) TTransportFactory {
+	return &tFramedTransportFactory{factory: factory, maxLength: maxLength}
 }
 
 func (p *tFramedTransportFactory) GetTransport(base TTransport) TTransport {
-	return NewTFramedTransport(p.factory.GetTransport(base))
+	return NewTFramedTransportMaxLength(p.factory.GetTransport(base), p.maxLength)
 }
 
 func NewTFramedTransport(transport TTransport) *TFramedTransport {
+	return NewTFramedTransportMaxLength(transport, DEFAULT_MAX_LENGTH)
+}
+
+// Creates a TFramedTransport rejecting frames larger than maxLength bytes.
+func NewTFramedTransportMaxLength(transport TTransport, maxLength int) *TFramedTransport {
 	writeBuf := make([]byte, 0, 1024)
 	readBuf := make([]byte, 0, 1024)
-	return &TFramedTransport{transport: transport, writeBuffer: bytes.NewBuffer(writeBuf), readBuffer: bytes.NewBuffer(readBuf)}
+	return &TFramedTransport{transport: transport, writeBuffer: bytes.NewBuffer(writeBuf), readBuffer: bytes.NewBuffer(readBuf), maxLength: maxLength}
 }
 
 func (p *TFramedTransport) Open() error {
@@ -74,7 +89,9 @@ func (p *TFramedTransport) Read(buf []byte) (int, error) {
 	}
 
 	// Read another frame of data
-	p.readFrame()
+	if _, err := p.readFrame(); err != nil {
+		return 0, NewTTransportExceptionFromError(err)
+	}
 
 	got, err := p.readBuffer.Read(buf)
 	return got, NewTTransportExceptionFromError(err)
@@ -91,10 +108,13 @@ func (p *TFramedTransport) Flush() error {
 	binary.BigEndian.PutUint32(buf, uint32(size))
 	_, err := p.transport.Write(buf)
 	if err != nil {
+		// Drop the frame, so that it does not precede the next one.
+		p.writeBuffer.Reset()
 		return NewTTransportExceptionFromError(err)
 	}
 	if size > 0 {
 		if n, err := p.writeBuffer.WriteTo(p.transport); err != nil {
+			p.writeBuffer.Reset()
 			print("Error while flushing write buffer of size ", size, " to transport, only wrote ", n, " bytes: ", err.Error(), "\n")
 			return NewTTransportExceptionFromError(err)
 		}
@@ -108,17 +128,22 @@ func (p *TFramedTransport) readFrame() (int, error) {
 	if _, err := io.ReadFull(p.transport, buf); err != nil {
 		return 0, err
 	}
-	size := int(binary.BigEndian.Uint32(buf))
-	if size < 0 {
-		return 0, NewTTransportException(UNKNOWN_TRANSPORT_EXCEPTION, "Read a negative frame size ("+string(size)+")")
+	size := binary.BigEndian.Uint32(buf)
+	if size > uint32(p.maxLength) {
+		return 0, NewTTransportException(UNKNOWN_TRANSPORT_EXCEPTION, fmt.Sprintf("Frame size %d exceeds the limit of %d", int32(size), p.maxLength))
 	}
 	if size == 0 {
 		return 0, nil
 	}
-	buf2 := make([]byte, size)
-	if n, err := io.ReadFull(p.transport, buf2); err != nil {
-		return n, err
+	buf2, err := readSizedBytes(p.transport, int(size))
+	if err != nil {
+		return len(buf2), err
 	}
 	p.readBuffer = bytes.NewBuffer(buf2)
-	return size, nil
+	return int(size), nil
+}
+
+// The rest of the current frame, which holds the rest of the message.
+func (p *TFramedTransport) remainingBytes() int {
+	return p.readBuffer.Len()
 }
@@ -0,0 +1,209 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Fuzz targets for the protocol and transport decoders. Run one of them with
+// e.g. go test -fuzz=FuzzCompactProtocol. Decoding arbitrary input must
+// fail with an error instead of panicking, hanging or allocating far beyond
+// the input size.
+
+// The skip depth used by the fuzz targets, low enough for deeply nested
+// input to hit the limit.
+const fuzzSkipDepth = 64
+
+// Lowers MaxSkipDepth to fuzzSkipDepth and returns a function restoring it.
+func limitSkipDepth() func() {
+	depth := MaxSkipDepth
+	MaxSkipDepth = fuzzSkipDepth
+	return func() { MaxSkipDepth = depth }
+}
+
+func fuzzTestStruct() *TestStruct {
+	return &TestStruct{
+		On:         true,
+		B:          -1,
+		Int16:      -2,
+		Int32:      300,
+		Int64:      -1 << 40,
+		D:          3.5,
+		St:         "fuzz \"me\"",
+		Bin:        []byte{0, 1, 0xff},
+		StringMap:  map[string]string{"k": "v"},
+		StringList: []string{"a", "b"},
+		StringSet:  map[string]bool{"s": true},
+		E:          TestEnum_THIRD,
+	}
+}
+
+// Seeds a protocol target with an encoded TestStruct, an encoded message and
+// the conformance vectors of that encoding.
+func addProtocolSeeds(f *testing.F, newProtocol func(TTransport) TProtocol, encoding string) {
+	trans := NewTMemoryBuffer()
+	p := newProtocol(trans)
+	if err := fuzzTestStruct().Write(p); err != nil {
+		f.Fatal(err)
+	}
+	p.Flush()
+	f.Add(append([]byte(nil), trans.Bytes()...))
+
+	trans = NewTMemoryBuffer()
+	p = newProtocol(trans)
+	p.WriteMessageBegin("testStruct", CALL, 1)
+	fuzzTestStruct().Write(p)
+	p.WriteMessageEnd()
+	p.Flush()
+	f.Add(append([]byte(nil), trans.Bytes()...))
+
+	if encoding == "" {
+		return
+	}
+	paths, _ := filepath.Glob(filepath.Join("testdata", "conformance", "*."+encoding))
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		if encoding == "json" {
+			f.Add(data)
+			continue
+		}
+		f.Add(readConformanceVector(f, path))
+	}
+}
+
+// Decodes data as a TestStruct, as a struct walked by Skip and as a message,
+// each from a fresh transport.
+func fuzzProtocol(t *testing.T, data []byte, newProtocol func(TTransport) TProtocol) {
+	p := newProtocol(NewTMemoryBuffer())
+	p.Transport().Write(data)
+	s := NewTestStruct()
+	if err := s.Read(p); err == nil {
+		// Whatever was read must be writable again.
+		if err := s.Write(newProtocol(NewTMemoryBuffer())); err != nil {
+			t.Fatalf("unable to write decoded %s: %s", s, err)
+		}
+	}
+
+	p = newProtocol(NewTMemoryBuffer())
+	p.Transport().Write(data)
+	p.Skip(STRUCT)
+
+	p = newProtocol(NewTMemoryBuffer())
+	p.Transport().Write(data)
+	if _, _, _, err := p.ReadMessageBegin(); err == nil {
+		if err := p.Skip(STRUCT); err == nil {
+			p.ReadMessageEnd()
+		}
+	}
+}
+
+func FuzzBinaryProtocol(f *testing.F) {
+	newProtocol := func(trans TTransport) TProtocol {
+		return NewTBinaryProtocol(trans, false, true)
+	}
+	addProtocolSeeds(f, newProtocol, "binary")
+	defer limitSkipDepth()()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzProtocol(t, data, newProtocol)
+	})
+}
+
+func FuzzCompactProtocol(f *testing.F) {
+	newProtocol := func(trans TTransport) TProtocol {
+		return NewTCompactProtocol(trans)
+	}
+	addProtocolSeeds(f, newProtocol, "compact")
+	defer limitSkipDepth()()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzProtocol(t, data, newProtocol)
+	})
+}
+
+func FuzzJSONProtocol(f *testing.F) {
+	newProtocol := func(trans TTransport) TProtocol {
+		return NewTJSONProtocol(trans)
+	}
+	addProtocolSeeds(f, newProtocol, "json")
+	defer limitSkipDepth()()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzProtocol(t, data, newProtocol)
+	})
+}
+
+func FuzzSimpleJSONProtocol(f *testing.F) {
+	newProtocol := func(trans TTransport) TProtocol {
+		return NewTSimpleJSONProtocol(trans)
+	}
+	addProtocolSeeds(f, newProtocol, "")
+	defer limitSkipDepth()()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzProtocol(t, data, newProtocol)
+	})
+}
+
+func FuzzFramedTransport(f *testing.F) {
+	const maxLength = 1024
+	defer limitSkipDepth()()
+	trans := NewTMemoryBuffer()
+	p := NewTBinaryProtocolTransport(NewTFramedTransport(trans))
+	p.WriteMessageBegin("testStruct", CALL, 1)
+	fuzzTestStruct().Write(p)
+	p.WriteMessageEnd()
+	p.Flush()
+	f.Add(append([]byte(nil), trans.Bytes()...))
+	f.Add([]byte{0, 0, 0, 2, 'h', 'i', 0, 0, 0, 0, 0x7f, 0xff, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		trans := NewTMemoryBuffer()
+		trans.Write(data)
+		framed := NewTFramedTransportMaxLength(trans, maxLength)
+		buf := make([]byte, 100)
+		for {
+			n, err := framed.Read(buf)
+			if n > len(buf) {
+				t.Fatalf("read %d bytes into a buffer of %d", n, len(buf))
+			}
+			if err != nil {
+				if n > 0 {
+					t.Fatalf("read %d bytes and error %s", n, err)
+				}
+				break
+			}
+			if framed.readBuffer.Len() > maxLength {
+				t.Fatalf("frame of %d bytes exceeds the limit", framed.readBuffer.Len())
+			}
+			if n == 0 && trans.Len() == 0 && framed.readBuffer.Len() == 0 {
+				break
+			}
+		}
+
+		trans = NewTMemoryBuffer()
+		trans.Write(data)
+		p := NewTBinaryProtocolTransport(NewTFramedTransportMaxLength(trans, maxLength))
+		if _, _, _, err := p.ReadMessageBegin(); err == nil {
+			NewTestStruct().Read(p)
+		}
+	})
+}
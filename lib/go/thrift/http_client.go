@@ -22,102 +22,204 @@ package thrift
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
+	"time"
 )
 
+// The client used by THttpClient transports created without an explicit
+// client or connect timeout. Sharing it lets consecutive transports reuse
+// idle connections.
+var DefaultHttpClient *http.Client = http.DefaultClient
+
+// The most bytes of an unread response drained to keep its connection
+// reusable.
+const maxHttpDrainBytes = 64 * 1024
+
+var (
+	httpTransportsLock sync.Mutex
+	httpTransports     = map[time.Duration]*http.Transport{}
+)
+
+// Returns the transport shared by all clients with the given connect timeout.
+func sharedHttpTransport(connectTimeout time.Duration) *http.Transport {
+	httpTransportsLock.Lock()
+	defer httpTransportsLock.Unlock()
+	if t, ok := httpTransports[connectTimeout]; ok {
+		return t
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	httpTransports[connectTimeout] = t
+	return t
+}
+
+type THttpClientOptions struct {
+	// The client sending the requests. If nil, DefaultHttpClient is used,
+	// or a client sharing its connections with all others using the same
+	// ConnectTimeout.
+	Client *http.Client
+
+	// The time allowed to establish a connection. Only used when Client is
+	// nil; zero means no timeout.
+	ConnectTimeout time.Duration
+
+	// The time allowed for a request, from sending it until its response has
+	// been read completely; zero means no timeout.
+	ReadTimeout time.Duration
+
+	// Headers sent with every request.
+	Header http.Header
+}
+
+func (o THttpClientOptions) httpClient() *http.Client {
+	client := o.Client
+	if client == nil {
+		if o.ConnectTimeout > 0 {
+			client = &http.Client{Transport: sharedHttpTransport(o.ConnectTimeout)}
+		} else {
+			client = DefaultHttpClient
+		}
+	}
+	if o.ReadTimeout > 0 {
+		c := *client
+		c.Timeout = o.ReadTimeout
+		client = &c
+	}
+	return client
+}
+
+// The transport exception returned for a response with a status other than
+// 200 OK.
+type THttpTransportException struct {
+	StatusCode int
+	Status     string
+}
+
+func (p *THttpTransportException) TypeId() int {
+	switch p.StatusCode {
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return TIMED_OUT
+	}
+	return UNKNOWN_TRANSPORT_EXCEPTION
+}
+
+func (p *THttpTransportException) Error() string {
+	return "HTTP Response code: " + strconv.Itoa(p.StatusCode)
+}
+
+func (p *THttpTransportException) Err() error {
+	return p
+}
+
+// A transport sending each message as the body of a POST request and reading
+// the reply from the body of its response. Neither the transport nor its
+// headers may be used concurrently.
 type THttpClient struct {
-	url                *url.URL
-	client             *http.Client
-	requestBuffer      *bytes.Buffer
-	responseBuffer     *bytes.Buffer
-	nsecConnectTimeout int64
-	nsecReadTimeout    int64
+	client        *http.Client
+	response      *http.Response
+	url           *url.URL
+	requestBuffer *bytes.Buffer
+	header        http.Header
 }
 
 type THttpClientTransportFactory struct {
-	url    string
-	isPost bool
-	client *http.Client
+	url     string
+	options THttpClientOptions
 }
 
 func (p *THttpClientTransportFactory) GetTransport(trans TTransport) TTransport {
 	if trans != nil {
 		t, ok := trans.(*THttpClient)
 		if ok && t.url != nil {
-			if t.requestBuffer != nil {
-				t2, _ := NewTHttpPostClient(t.url.String())
-				return t2
-			}
-			t2, _ := NewTHttpClient(t.url.String())
+			t2, _ := NewTHttpClientWithOptions(t.url.String(), THttpClientOptions{
+				Client: t.client,
+				Header: t.header,
+			})
 			return t2
 		}
 	}
-	if p.isPost {
-		s, _ := NewTHttpPostClient(p.url)
-		return s
-	}
-	s, _ := NewTHttpClient(p.url)
+	s, _ := NewTHttpClientWithOptions(p.url, p.options)
 	return s
 }
 
 func NewTHttpClientTransportFactory(url string) *THttpClientTransportFactory {
-	return &THttpClientTransportFactory{url: url, isPost: false}
+	return NewTHttpClientTransportFactoryWithOptions(url, THttpClientOptions{})
 }
 
 func NewTHttpPostClientTransportFactory(url string) *THttpClientTransportFactory {
-	return &THttpClientTransportFactory{url: url, isPost: true}
+	return NewTHttpClientTransportFactoryWithOptions(url, THttpClientOptions{})
 }
 
 func NewTHttpClientTransportFactoryWithClient(url string, client *http.Client) *THttpClientTransportFactory {
-	return &THttpClientTransportFactory{url: url, isPost: false, client: client}
+	return NewTHttpClientTransportFactoryWithOptions(url, THttpClientOptions{Client: client})
 }
 
 func NewTHttpPostClientTransportFactoryWithClient(url string, client *http.Client) *THttpClientTransportFactory {
-	return &THttpClientTransportFactory{url: url, isPost: true, client: client}
+	return NewTHttpClientTransportFactoryWithOptions(url, THttpClientOptions{Client: client})
+}
+
+func NewTHttpClientTransportFactoryWithOptions(url string, options THttpClientOptions) *THttpClientTransportFactory {
+	return &THttpClientTransportFactory{url: url, options: options}
 }
 
 func NewTHttpClient(urlstr string) (TTransport, error) {
-	return NewTHttpClientWithClient(urlstr, nil)
+	return NewTHttpClientWithOptions(urlstr, THttpClientOptions{})
 }
 
 func NewTHttpClientWithClient(urlstr string, client *http.Client) (TTransport, error) {
-	parsedURL, err := url.Parse(urlstr)
-	if err != nil {
-		return nil, err
-	}
-	if client == nil {
-		client = http.DefaultClient
-	}
-	response, err := client.Get(urlstr)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
-	if response.StatusCode != http.StatusOK {
-		// TODO(pomack) log bad response
-		return nil, NewTTransportException(UNKNOWN_TRANSPORT_EXCEPTION, "HTTP Response code: "+strconv.Itoa(response.StatusCode))
-	}
-	responseBuffer := &bytes.Buffer{}
-	_, err = io.Copy(responseBuffer, response.Body)
-	if err != nil {
-		return nil, err
-	}
-	return &THttpClient{responseBuffer: responseBuffer, url: parsedURL, client: client}, nil
+	return NewTHttpClientWithOptions(urlstr, THttpClientOptions{Client: client})
 }
 
 func NewTHttpPostClient(urlstr string) (TTransport, error) {
-	return NewTHttpPostClientWithClient(urlstr, nil)
+	return NewTHttpClientWithOptions(urlstr, THttpClientOptions{})
 }
 
 func NewTHttpPostClientWithClient(urlstr string, client *http.Client) (TTransport, error) {
+	return NewTHttpClientWithOptions(urlstr, THttpClientOptions{Client: client})
+}
+
+// Creates a THttpClient for the url. No request is made before the first
+// Flush.
+func NewTHttpClientWithOptions(urlstr string, options THttpClientOptions) (TTransport, error) {
 	parsedURL, err := url.Parse(urlstr)
 	if err != nil {
 		return nil, err
 	}
+	header := http.Header{}
+	for k, v := range options.Header {
+		header[k] = append([]string(nil), v...)
+	}
 	buf := make([]byte, 0, 1024)
-	return &THttpClient{url: parsedURL, requestBuffer: bytes.NewBuffer(buf), client: client}, nil
+	return &THttpClient{
+		client:        options.httpClient(),
+		url:           parsedURL,
+		requestBuffer: bytes.NewBuffer(buf),
+		header:        header,
+	}, nil
+}
+
+// Sets a header sent with every following request, replacing any values
+// already set for the key.
+func (p *THttpClient) SetHeader(key string, value string) {
+	p.header.Set(key, value)
+}
+
+// Returns the first value of a header sent with the requests.
+func (p *THttpClient) GetHeader(key string) string {
+	return p.header.Get(key)
+}
+
+// Stops sending a header with the requests.
+func (p *THttpClient) DelHeader(key string) {
+	p.header.Del(key)
 }
 
 func (p *THttpClient) Open() error {
@@ -126,7 +228,7 @@ func (p *THttpClient) Open() error {
 }
 
 func (p *THttpClient) IsOpen() bool {
-	return p.responseBuffer != nil || p.requestBuffer != nil
+	return p.response != nil || p.requestBuffer != nil
 }
 
 func (p *THttpClient) Peek() bool {
@@ -134,15 +236,29 @@ func (p *THttpClient) Peek() bool {
 }
 
 func (p *THttpClient) Close() error {
-	p.responseBuffer = nil
+	p.closeResponse()
 	return nil
 }
 
+// Releases the current response. Its connection is only reused once the body
+// has been read completely, so a small remainder is drained first.
+func (p *THttpClient) closeResponse() {
+	if p.response == nil {
+		return
+	}
+	io.CopyN(ioutil.Discard, p.response.Body, maxHttpDrainBytes)
+	p.response.Body.Close()
+	p.response = nil
+}
+
 func (p *THttpClient) Read(buf []byte) (int, error) {
-	if p.responseBuffer == nil {
+	if p.response == nil {
 		return 0, NewTTransportException(NOT_OPEN, "Response buffer is empty, no request.")
 	}
-	n, err := p.responseBuffer.Read(buf)
+	n, err := p.response.Body.Read(buf)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
 	return n, NewTTransportExceptionFromError(err)
 }
 
@@ -151,20 +267,31 @@ func (p *THttpClient) Write(buf []byte) (int, error) {
 	return n, err
 }
 
+// Sends the buffered message. The response body is read as the reply is
+// decoded rather than buffered.
 func (p *THttpClient) Flush() error {
-	if p.client == nil {
-		p.client = http.DefaultClient
+	p.closeResponse()
+	req, err := http.NewRequest("POST", p.url.String(), p.requestBuffer)
+	if err != nil {
+		p.requestBuffer.Reset()
+		return NewTTransportExceptionFromError(err)
 	}
-	response, err := p.client.Post(p.url.String(), "application/x-thrift", p.requestBuffer)
+	for k, v := range p.header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/x-thrift")
+	}
+	response, err := p.client.Do(req)
+	p.requestBuffer.Reset()
 	if err != nil {
 		return NewTTransportExceptionFromError(err)
 	}
-	defer response.Body.Close()
 	if response.StatusCode != http.StatusOK {
-		// TODO(pomack) log bad response
-		return NewTTransportException(UNKNOWN_TRANSPORT_EXCEPTION, "HTTP Response code: "+strconv.Itoa(response.StatusCode))
+		p.response = response
+		p.closeResponse()
+		return &THttpTransportException{StatusCode: response.StatusCode, Status: response.Status}
 	}
-	p.responseBuffer = &bytes.Buffer{}
-	_, err = io.Copy(p.responseBuffer, response.Body)
-	return err
+	p.response = response
+	return nil
 }
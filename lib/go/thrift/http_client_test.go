@@ -20,7 +20,13 @@
 package thrift
 
 import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestHttpClient(t *testing.T) {
@@ -35,3 +41,140 @@ func TestHttpClient(t *testing.T) {
 	}
 	TransportTest(t, trans, trans)
 }
+
+func TestHttpClientNoRequestBeforeFlush(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+	if _, err := NewTHttpClient(server.URL); err != nil {
+		t.Fatalf("Unable to create client: %s", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Fatalf("Expected no request before flush, got %d", n)
+	}
+}
+
+func TestHttpClientHeaders(t *testing.T) {
+	headers := make(chan http.Header, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		headers <- req.Header
+	}))
+	defer server.Close()
+	trans, err := NewTHttpClientWithOptions(server.URL, THttpClientOptions{
+		Header: http.Header{"X-Client": {"test"}},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create client: %s", err)
+	}
+	client := trans.(*THttpClient)
+	client.SetHeader("Authorization", "Bearer token1")
+	client.Write([]byte("a"))
+	if err := client.Flush(); err != nil {
+		t.Fatalf("Unable to flush: %s", err)
+	}
+	h := <-headers
+	if h.Get("X-Client") != "test" || h.Get("Authorization") != "Bearer token1" || h.Get("Content-Type") != "application/x-thrift" {
+		t.Fatalf("Unexpected request headers %v", h)
+	}
+
+	client.SetHeader("Authorization", "Bearer token2")
+	client.DelHeader("X-Client")
+	client.Write([]byte("b"))
+	if err := client.Flush(); err != nil {
+		t.Fatalf("Unable to flush: %s", err)
+	}
+	h = <-headers
+	if h.Get("X-Client") != "" || h.Get("Authorization") != "Bearer token2" {
+		t.Fatalf("Unexpected request headers %v", h)
+	}
+}
+
+func TestHttpClientStatusException(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "denied", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	trans, _ := NewTHttpPostClient(server.URL)
+	trans.Write([]byte("a"))
+	err := trans.Flush()
+	e, ok := err.(*THttpTransportException)
+	if !ok {
+		t.Fatalf("Expected a THttpTransportException, got %T %v", err, err)
+	}
+	if e.StatusCode != http.StatusUnauthorized || e.TypeId() != UNKNOWN_TRANSPORT_EXCEPTION {
+		t.Fatalf("Unexpected exception %d %d", e.StatusCode, e.TypeId())
+	}
+	if _, err := trans.Read(make([]byte, 1)); err.(TTransportException).TypeId() != NOT_OPEN {
+		t.Fatalf("Expected NOT_OPEN reading after a failed request, got %v", err)
+	}
+}
+
+func TestHttpClientReadTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+	trans, _ := NewTHttpClientWithOptions(server.URL, THttpClientOptions{ReadTimeout: 50 * time.Millisecond})
+	trans.Write([]byte("a"))
+	err := trans.Flush()
+	if e, ok := err.(TTransportException); !ok || e.TypeId() != TIMED_OUT {
+		t.Fatalf("Expected TIMED_OUT, got %v", err)
+	}
+}
+
+func TestHttpClientStreamsResponse(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second"))
+	}))
+	defer server.Close()
+	trans, _ := NewTHttpClient(server.URL)
+	trans.Write([]byte("a"))
+	if err := trans.Flush(); err != nil {
+		close(release)
+		t.Fatalf("Unable to flush: %s", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := trans.Read(buf); err != nil || string(buf) != "first" {
+		close(release)
+		t.Fatalf("Expected the first part before the response completed, got %q %v", buf, err)
+	}
+	close(release)
+	rest := make([]byte, 6)
+	if _, err := io.ReadFull(trans, rest); err != nil || string(rest) != "second" {
+		t.Fatalf("Unexpected rest of the response %q %v", rest, err)
+	}
+}
+
+func TestHttpClientReusesConnections(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("reply"))
+	}))
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	for i := 0; i < 3; i++ {
+		trans, _ := NewTHttpClientWithOptions(server.URL, THttpClientOptions{ConnectTimeout: time.Second})
+		trans.Write([]byte("a"))
+		if err := trans.Flush(); err != nil {
+			t.Fatalf("Unable to flush: %s", err)
+		}
+		trans.Read(make([]byte, 2))
+		trans.Close()
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Fatalf("Expected requests to share one connection, got %d connections", n)
+	}
+}
@@ -1,7 +1,10 @@
 package thrift
 
 import (
+	"mime"
+	"net"
 	"net/http"
+	"strings"
 )
 
 /*
@@ -12,8 +15,26 @@ import (
  * to Serve() as normal. However, you can also use it as a handler in another
  * http server by calling Handle() as needed. This lets you support other URLs
  * on the same server.
+ *
+ * Once protocols are registered per media type, the protocol of each request
+ * is chosen from its Content-Type and that of the response from its Accept
+ * header, so clients of different protocols can share one URL.
  */
 
+// The media types registered by THttpServer.EnableProtocolNegotiation.
+const (
+	THRIFT_CONTENT_TYPE         = "application/x-thrift"
+	THRIFT_BINARY_CONTENT_TYPE  = "application/vnd.apache.thrift.binary"
+	THRIFT_COMPACT_CONTENT_TYPE = "application/vnd.apache.thrift.compact"
+	THRIFT_JSON_CONTENT_TYPE    = "application/vnd.apache.thrift.json"
+)
+
+type tHttpProtocol struct {
+	contentType           string
+	inputProtocolFactory  TProtocolFactory
+	outputProtocolFactory TProtocolFactory
+}
+
 type THttpServer struct {
 	addr              string
 	cors              bool
@@ -26,6 +47,10 @@ type THttpServer struct {
 	outputTransportFactory TTransportFactory
 	inputProtocolFactory   TProtocolFactory
 	outputProtocolFactory  TProtocolFactory
+	logger                 Logger
+	eventHandler           TServerEventHandler
+	authorizer             TAuthorizer
+	protocols              []tHttpProtocol
 }
 
 // Prepares a HTTP server.
@@ -37,6 +62,7 @@ func NewHttpServer(addr string, processorFactory TProcessorFactory, inputProtoco
 		outputTransportFactory: NewTTransportFactory(),
 		inputProtocolFactory:   inputProtocolFactory,
 		outputProtocolFactory:  outputProtocolFactory,
+		logger:                 StdLogger(nil),
 	}
 }
 
@@ -51,6 +77,7 @@ func NewHttpsServer(addr, certFile, keyFile string, processorFactory TProcessorF
 		outputTransportFactory: NewTTransportFactory(),
 		inputProtocolFactory:   inputProtocolFactory,
 		outputProtocolFactory:  outputProtocolFactory,
+		logger:                 StdLogger(nil),
 	}
 }
 
@@ -59,8 +86,98 @@ func (srv *THttpServer) SetCorsEnabled(enabled bool) {
 	srv.cors = enabled
 }
 
+// Sets the logger used for the stack of recovered handler panics.
+func (srv *THttpServer) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = NopLogger
+	}
+	srv.logger = logger
+}
+
+// Sets the handler notified of server and request lifecycle events. Every
+// HTTP request is treated as a connection of its own.
+func (srv *THttpServer) SetServerEventHandler(handler TServerEventHandler) {
+	srv.eventHandler = handler
+}
+
+// Sets the authorizer consulted for every request and every call. Refused
+// requests are answered with 403 Forbidden.
+func (srv *THttpServer) SetAuthorizer(authorizer TAuthorizer) {
+	srv.authorizer = authorizer
+}
+
+// Registers the protocols used for requests with the given Content-Type and
+// for responses accepting it. Once any media type is registered, requests
+// with a Content-Type that is not are refused with 415 Unsupported Media Type.
+// Requests without a Content-Type keep using the server's protocol factories.
+func (srv *THttpServer) SetContentTypeProtocol(contentType string, inputProtocolFactory TProtocolFactory, outputProtocolFactory TProtocolFactory) {
+	contentType = strings.ToLower(contentType)
+	p := tHttpProtocol{contentType, inputProtocolFactory, outputProtocolFactory}
+	for i := range srv.protocols {
+		if srv.protocols[i].contentType == contentType {
+			srv.protocols[i] = p
+			return
+		}
+	}
+	srv.protocols = append(srv.protocols, p)
+}
+
+// Registers the binary protocol as application/vnd.apache.thrift.binary,
+// the compact protocol as application/vnd.apache.thrift.compact and the JSON
+// protocol as application/vnd.apache.thrift.json. Requests sent as
+// application/x-thrift, which THttpClient sends whatever its protocol, or as
+// text/plain, as older clients do, keep using the server's protocol
+// factories.
+func (srv *THttpServer) EnableProtocolNegotiation() {
+	binary := NewTBinaryProtocolFactoryDefault()
+	compact := NewTCompactProtocolFactory()
+	json := NewTJSONProtocolFactory()
+	srv.SetContentTypeProtocol("text/plain", srv.inputProtocolFactory, srv.outputProtocolFactory)
+	srv.SetContentTypeProtocol(THRIFT_CONTENT_TYPE, srv.inputProtocolFactory, srv.outputProtocolFactory)
+	srv.SetContentTypeProtocol(THRIFT_BINARY_CONTENT_TYPE, binary, binary)
+	srv.SetContentTypeProtocol(THRIFT_COMPACT_CONTENT_TYPE, compact, compact)
+	srv.SetContentTypeProtocol(THRIFT_JSON_CONTENT_TYPE, json, json)
+}
+
+func (srv *THttpServer) lookupProtocol(contentType string) *tHttpProtocol {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	for i := range srv.protocols {
+		if srv.protocols[i].contentType == mediaType {
+			return &srv.protocols[i]
+		}
+	}
+	return nil
+}
+
+// Chooses the protocols of a request. The response uses the first registered
+// media type listed in the Accept header, or else the request's own.
+func (srv *THttpServer) negotiateProtocols(req *http.Request) (in TProtocolFactory, out TProtocolFactory, contentType string, ok bool) {
+	requestType := req.Header.Get("Content-Type")
+	if len(srv.protocols) == 0 || requestType == "" {
+		return srv.inputProtocolFactory, srv.outputProtocolFactory, "", true
+	}
+	p := srv.lookupProtocol(requestType)
+	if p == nil {
+		return nil, nil, "", false
+	}
+	in, out, contentType = p.inputProtocolFactory, p.outputProtocolFactory, p.contentType
+	for _, accepted := range strings.Split(req.Header.Get("Accept"), ",") {
+		if a := srv.lookupProtocol(accepted); a != nil {
+			out, contentType = a.outputProtocolFactory, a.contentType
+			break
+		}
+	}
+	return in, out, contentType, true
+}
+
 // Starts listening to the address and processing requests
 func (srv *THttpServer) Serve() error {
+	if srv.eventHandler != nil {
+		srv.eventHandler.PreServe()
+	}
 	if srv.certFile != "" {
 		return http.ListenAndServeTLS(srv.addr, srv.certFile, srv.keyFile, http.HandlerFunc(srv.Handle))
 	} else {
@@ -93,22 +210,62 @@ func (srv *THttpServer) Handle(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	inputProtocolFactory, outputProtocolFactory, contentType, ok := srv.negotiateProtocols(req)
+	if !ok {
+		http.Error(w, "Unsupported Content-Type: "+req.Header.Get("Content-Type"), http.StatusUnsupportedMediaType)
+		return
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
 	// Prepare the protocol stack
 	client := &StreamTransport{
 		Reader: req.Body,
 		Writer: w,
 	}
-	processor := srv.processorFactory.GetProcessor(client)
+	ctx := &TConnectionContext{}
+	if addr, err := net.ResolveTCPAddr("tcp", req.RemoteAddr); err == nil {
+		ctx.RemoteAddr = addr
+	}
+	ctx.LocalAddr, _ = req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	ctx.TLSState = req.TLS
 	inputTransport := srv.inputTransportFactory.GetTransport(client)
 	outputTransport := srv.outputTransportFactory.GetTransport(client)
-	inputProtocol := srv.inputProtocolFactory.GetProtocol(inputTransport)
-	outputProtocol := srv.outputProtocolFactory.GetProtocol(outputTransport)
+	inputProtocol := newTHeaderRecordingProtocol(inputProtocolFactory.GetProtocol(inputTransport))
+	outputProtocol := outputProtocolFactory.GetProtocol(outputTransport)
 	if inputTransport != nil {
 		defer inputTransport.Close()
 	}
 	if outputTransport != nil {
 		defer outputTransport.Close()
 	}
+	registerConnectionContext(ctx, client, inputTransport, outputTransport)
+	defer unregisterConnectionContext(client, inputTransport, outputTransport)
+	if srv.eventHandler != nil {
+		defer srv.eventHandler.DeleteContext(ctx, inputProtocol, outputProtocol)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			srv.LastError = recoverHandlerPanic(srv.logger, r, inputProtocol.name, inputProtocol.typeId, inputProtocol.seqId, outputProtocol)
+		}
+	}()
+	if srv.eventHandler != nil {
+		srv.eventHandler.CreateContext(ctx, inputProtocol, outputProtocol)
+	}
+	if srv.authorizer != nil {
+		if err := srv.authorizer.AuthorizeConnection(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	if srv.eventHandler != nil {
+		srv.eventHandler.ProcessContext(ctx, client)
+	}
+	processor := srv.processorFactory.GetProcessor(client)
+	if srv.authorizer != nil {
+		processor = WrapProcessor(processor, NewAuthorizationProcessorMiddleware(srv.authorizer))
+	}
 
 	// Process the request
 	_, srv.LastError = processor.Process(inputProtocol, outputProtocol)
@@ -0,0 +1,210 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestNegotiatingServer() *httptest.Server {
+	binary := NewTBinaryProtocolFactoryDefault()
+	srv := NewHttpServer("", NewTProcessorFactory(&testEchoProcessor{}), binary, binary)
+	srv.SetLogger(NopLogger)
+	srv.EnableProtocolNegotiation()
+	return httptest.NewServer(http.HandlerFunc(srv.Handle))
+}
+
+func TestHttpServerProtocolNegotiation(t *testing.T) {
+	server := newTestNegotiatingServer()
+	defer server.Close()
+	protocols := map[string]TProtocolFactory{
+		"":                          NewTBinaryProtocolFactoryDefault(),
+		THRIFT_CONTENT_TYPE:         NewTBinaryProtocolFactoryDefault(),
+		THRIFT_BINARY_CONTENT_TYPE:  NewTBinaryProtocolFactoryDefault(),
+		THRIFT_COMPACT_CONTENT_TYPE: NewTCompactProtocolFactory(),
+		THRIFT_JSON_CONTENT_TYPE + "; charset=utf-8": NewTJSONProtocolFactory(),
+	}
+	for contentType, protocolFactory := range protocols {
+		trans, _ := NewTHttpClient(server.URL)
+		if contentType != "" {
+			trans.(*THttpClient).SetHeader("Content-Type", contentType)
+		}
+		p := protocolFactory.GetProtocol(trans)
+		result := &testCallStruct{}
+		if err := NewTStandardClient(p, p).Call("echo", &testCallStruct{42}, result); err != nil {
+			t.Fatalf("%q: call failed: %s", contentType, err)
+		}
+		if result.Value != 42 {
+			t.Fatalf("%q: expected 42, got %d", contentType, result.Value)
+		}
+	}
+}
+
+func encodeTestCall(protocolFactory TProtocolFactory) *bytes.Buffer {
+	trans := NewTMemoryBuffer()
+	p := protocolFactory.GetProtocol(trans)
+	p.WriteMessageBegin("echo", CALL, 1)
+	(&testCallStruct{7}).Write(p)
+	p.WriteMessageEnd()
+	p.Flush()
+	return trans.Buffer
+}
+
+func TestHttpServerResponseContentType(t *testing.T) {
+	server := newTestNegotiatingServer()
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, encodeTestCall(NewTCompactProtocolFactory()))
+	req.Header.Set("Content-Type", THRIFT_COMPACT_CONTENT_TYPE)
+	req.Header.Set("Accept", "text/html, "+THRIFT_JSON_CONTENT_TYPE+";q=0.9")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != THRIFT_JSON_CONTENT_TYPE {
+		t.Fatalf("Expected Content-Type %s, got %s", THRIFT_JSON_CONTENT_TYPE, ct)
+	}
+	p := NewTJSONProtocol(NewTMemoryBufferLen(0))
+	p.Transport().Write(body)
+	if name, typeId, _, err := p.ReadMessageBegin(); err != nil || name != "echo" || typeId != REPLY {
+		t.Fatalf("Unexpected JSON reply %q: %s", body, err)
+	}
+
+	resp, err = http.Post(server.URL, THRIFT_CONTENT_TYPE, encodeTestCall(NewTBinaryProtocolFactoryDefault()))
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != THRIFT_CONTENT_TYPE {
+		t.Fatalf("Expected Content-Type %s, got %s", THRIFT_CONTENT_TYPE, ct)
+	}
+}
+
+// Requests without a Content-Type, or sent as text/plain, use the protocols
+// the server was created with.
+func TestHttpServerDefaultProtocol(t *testing.T) {
+	server := newTestNegotiatingServer()
+	defer server.Close()
+	for _, contentType := range []string{"", "text/plain", "text/plain; charset=utf-8"} {
+		req, _ := http.NewRequest("POST", server.URL, encodeTestCall(NewTBinaryProtocolFactoryDefault()))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%q: request failed: %s", contentType, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%q: expected status 200, got %d", contentType, resp.StatusCode)
+		}
+		p := NewTBinaryProtocolTransport(NewTMemoryBufferLen(0))
+		p.Transport().Write(body)
+		result := &testCallStruct{}
+		if err := new(TStandardClient).Recv(p, 1, "echo", result); err != nil || result.Value != 7 {
+			t.Fatalf("%q: unexpected binary reply %q: %v", contentType, body, err)
+		}
+	}
+}
+
+// THttpClient sends application/x-thrift for every protocol, so existing
+// clients of a server using another protocol keep working.
+func TestHttpServerNegotiationKeepsDefaultProtocol(t *testing.T) {
+	json := NewTJSONProtocolFactory()
+	srv := NewHttpServer("", NewTProcessorFactory(&testEchoProcessor{}), json, json)
+	srv.SetLogger(NopLogger)
+	srv.EnableProtocolNegotiation()
+	server := httptest.NewServer(http.HandlerFunc(srv.Handle))
+	defer server.Close()
+
+	trans, _ := NewTHttpClient(server.URL)
+	p := json.GetProtocol(trans)
+	result := &testCallStruct{}
+	if err := NewTStandardClient(p, p).Call("echo", &testCallStruct{42}, result); err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	if result.Value != 42 {
+		t.Fatalf("Expected 42, got %d", result.Value)
+	}
+}
+
+func TestHttpServerUnsupportedContentType(t *testing.T) {
+	server := newTestNegotiatingServer()
+	defer server.Close()
+	for _, contentType := range []string{"text/html", "application/json", "not a media type"} {
+		resp, err := http.Post(server.URL, contentType, encodeTestCall(NewTBinaryProtocolFactoryDefault()))
+		if err != nil {
+			t.Fatalf("Request failed: %s", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnsupportedMediaType {
+			t.Fatalf("%q: expected status 415, got %d", contentType, resp.StatusCode)
+		}
+	}
+
+	trans, _ := NewTHttpClient(server.URL)
+	trans.(*THttpClient).SetHeader("Content-Type", "application/json")
+	trans.Write([]byte{0})
+	if e, ok := trans.Flush().(*THttpTransportException); !ok || e.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("Expected a 415 THttpTransportException, got %v", e)
+	}
+}
+
+// Processor that records the remote address of its connection context.
+type testRemoteAddrProcessor struct {
+	testEchoProcessor
+	remoteAddr net.Addr
+}
+
+func (p *testRemoteAddrProcessor) Process(in, out TProtocol) (bool, TException) {
+	if ctx, ok := GetConnectionContext(in.Transport()); ok {
+		p.remoteAddr = ctx.RemoteAddr
+	}
+	return p.testEchoProcessor.Process(in, out)
+}
+
+func TestHttpServerUnresolvedRemoteAddr(t *testing.T) {
+	processor := &testRemoteAddrProcessor{}
+	binary := NewTBinaryProtocolFactoryDefault()
+	srv := NewHttpServer("", NewTProcessorFactory(processor), binary, binary)
+	srv.SetLogger(NopLogger)
+
+	req := httptest.NewRequest("POST", "/", encodeTestCall(binary))
+	req.RemoteAddr = "@"
+	srv.Handle(httptest.NewRecorder(), req)
+	if processor.remoteAddr != nil {
+		t.Fatalf("Expected no remote address, got %#v", processor.remoteAddr)
+	}
+
+	req = httptest.NewRequest("POST", "/", encodeTestCall(binary))
+	req.RemoteAddr = "192.0.2.1:1234"
+	srv.Handle(httptest.NewRecorder(), req)
+	if processor.remoteAddr == nil || processor.remoteAddr.String() != "192.0.2.1:1234" {
+		t.Fatalf("Expected remote address 192.0.2.1:1234, got %v", processor.remoteAddr)
+	}
+}
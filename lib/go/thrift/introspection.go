@@ -0,0 +1,557 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The name under which the introspection service is usually registered on a
+// TMultiplexedProcessor.
+const INTROSPECTION_SERVICE_NAME = "ThriftIntrospection"
+
+// The introspection service is defined by the following IDL. Its types are
+// written out here as the compiler would generate them, so that they are
+// available without a generated package.
+//
+//	struct TServiceInfo {
+//	  1: string name
+//	  2: list<string> methods
+//	}
+//
+//	struct TServerInfo {
+//	  1: string version
+//	  2: string libraryVersion
+//	  3: i64 startTime
+//	  4: i64 uptimeMillis
+//	  5: list<TServiceInfo> services
+//	  6: string serverTransport
+//	  7: string inputTransportFactory
+//	  8: string outputTransportFactory
+//	  9: string inputProtocolFactory
+//	  10: string outputProtocolFactory
+//	}
+//
+//	service ThriftIntrospection {
+//	  TServerInfo describe()
+//	}
+
+// A service registered on the multiplexed processor. Methods is empty if the
+// processor does not expose a ProcessorMap, as generated processors do.
+type TServiceInfo struct {
+	Name    string   `thrift:"name,1"`
+	Methods []string `thrift:"methods,2"`
+}
+
+func NewTServiceInfo() *TServiceInfo {
+	return &TServiceInfo{}
+}
+
+func (p *TServiceInfo) Read(iprot TProtocol) error {
+	return readIntrospectionStruct(p, iprot, func(id int16, typeId TType) (bool, error) {
+		var err error
+		switch {
+		case id == 1 && typeId == STRING:
+			p.Name, err = iprot.ReadString()
+		case id == 2 && typeId == LIST:
+			p.Methods, err = readIntrospectionStrings(iprot)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+func (p *TServiceInfo) Write(oprot TProtocol) error {
+	return writeIntrospectionStruct(p, oprot, "TServiceInfo", func() error {
+		if err := writeIntrospectionString(oprot, "name", 1, p.Name); err != nil {
+			return err
+		}
+		return writeIntrospectionStrings(oprot, "methods", 2, p.Methods)
+	})
+}
+
+func (p *TServiceInfo) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("TServiceInfo(%+v)", *p)
+}
+
+// The description of a running server. StartTime is in milliseconds since
+// the Unix epoch. The factories are named by their Go type and are empty if
+// the server is not known.
+type TServerInfo struct {
+	Version                string          `thrift:"version,1"`
+	LibraryVersion         string          `thrift:"libraryVersion,2"`
+	StartTime              int64           `thrift:"startTime,3"`
+	UptimeMillis           int64           `thrift:"uptimeMillis,4"`
+	Services               []*TServiceInfo `thrift:"services,5"`
+	ServerTransport        string          `thrift:"serverTransport,6"`
+	InputTransportFactory  string          `thrift:"inputTransportFactory,7"`
+	OutputTransportFactory string          `thrift:"outputTransportFactory,8"`
+	InputProtocolFactory   string          `thrift:"inputProtocolFactory,9"`
+	OutputProtocolFactory  string          `thrift:"outputProtocolFactory,10"`
+}
+
+func NewTServerInfo() *TServerInfo {
+	return &TServerInfo{}
+}
+
+func (p *TServerInfo) Read(iprot TProtocol) error {
+	return readIntrospectionStruct(p, iprot, func(id int16, typeId TType) (bool, error) {
+		var err error
+		switch {
+		case id == 1 && typeId == STRING:
+			p.Version, err = iprot.ReadString()
+		case id == 2 && typeId == STRING:
+			p.LibraryVersion, err = iprot.ReadString()
+		case id == 3 && typeId == I64:
+			p.StartTime, err = iprot.ReadI64()
+		case id == 4 && typeId == I64:
+			p.UptimeMillis, err = iprot.ReadI64()
+		case id == 5 && typeId == LIST:
+			p.Services, err = readIntrospectionServices(iprot)
+		case id == 6 && typeId == STRING:
+			p.ServerTransport, err = iprot.ReadString()
+		case id == 7 && typeId == STRING:
+			p.InputTransportFactory, err = iprot.ReadString()
+		case id == 8 && typeId == STRING:
+			p.OutputTransportFactory, err = iprot.ReadString()
+		case id == 9 && typeId == STRING:
+			p.InputProtocolFactory, err = iprot.ReadString()
+		case id == 10 && typeId == STRING:
+			p.OutputProtocolFactory, err = iprot.ReadString()
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+func (p *TServerInfo) Write(oprot TProtocol) error {
+	return writeIntrospectionStruct(p, oprot, "TServerInfo", func() error {
+		if err := writeIntrospectionString(oprot, "version", 1, p.Version); err != nil {
+			return err
+		}
+		if err := writeIntrospectionString(oprot, "libraryVersion", 2, p.LibraryVersion); err != nil {
+			return err
+		}
+		if err := writeIntrospectionI64(oprot, "startTime", 3, p.StartTime); err != nil {
+			return err
+		}
+		if err := writeIntrospectionI64(oprot, "uptimeMillis", 4, p.UptimeMillis); err != nil {
+			return err
+		}
+		if err := oprot.WriteFieldBegin("services", LIST, 5); err != nil {
+			return fmt.Errorf("%T write field begin error 5:services: %s", p, err)
+		}
+		if err := oprot.WriteListBegin(STRUCT, len(p.Services)); err != nil {
+			return fmt.Errorf("error writing list begin: %s", err)
+		}
+		for _, v := range p.Services {
+			if err := v.Write(oprot); err != nil {
+				return fmt.Errorf("%T error writing struct: %s", v, err)
+			}
+		}
+		if err := oprot.WriteListEnd(); err != nil {
+			return fmt.Errorf("error writing list end: %s", err)
+		}
+		if err := oprot.WriteFieldEnd(); err != nil {
+			return fmt.Errorf("%T write field end error 5:services: %s", p, err)
+		}
+		if err := writeIntrospectionString(oprot, "serverTransport", 6, p.ServerTransport); err != nil {
+			return err
+		}
+		if err := writeIntrospectionString(oprot, "inputTransportFactory", 7, p.InputTransportFactory); err != nil {
+			return err
+		}
+		if err := writeIntrospectionString(oprot, "outputTransportFactory", 8, p.OutputTransportFactory); err != nil {
+			return err
+		}
+		if err := writeIntrospectionString(oprot, "inputProtocolFactory", 9, p.InputProtocolFactory); err != nil {
+			return err
+		}
+		return writeIntrospectionString(oprot, "outputProtocolFactory", 10, p.OutputProtocolFactory)
+	})
+}
+
+func (p *TServerInfo) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("TServerInfo(%+v)", *p)
+}
+
+type tIntrospectionDescribeArgs struct{}
+
+func (p *tIntrospectionDescribeArgs) Read(iprot TProtocol) error {
+	return readIntrospectionStruct(p, iprot, func(id int16, typeId TType) (bool, error) {
+		return false, nil
+	})
+}
+
+func (p *tIntrospectionDescribeArgs) Write(oprot TProtocol) error {
+	return writeIntrospectionStruct(p, oprot, "describe_args", func() error {
+		return nil
+	})
+}
+
+type tIntrospectionDescribeResult struct {
+	Success *TServerInfo `thrift:"success,0"`
+}
+
+func (p *tIntrospectionDescribeResult) Read(iprot TProtocol) error {
+	return readIntrospectionStruct(p, iprot, func(id int16, typeId TType) (bool, error) {
+		if id == 0 && typeId == STRUCT {
+			p.Success = NewTServerInfo()
+			return true, p.Success.Read(iprot)
+		}
+		return false, nil
+	})
+}
+
+func (p *tIntrospectionDescribeResult) Write(oprot TProtocol) error {
+	return writeIntrospectionStruct(p, oprot, "describe_result", func() error {
+		if p.Success == nil {
+			return nil
+		}
+		if err := oprot.WriteFieldBegin("success", STRUCT, 0); err != nil {
+			return fmt.Errorf("%T write field begin error 0:success: %s", p, err)
+		}
+		if err := p.Success.Write(oprot); err != nil {
+			return fmt.Errorf("%T error writing struct: %s", p.Success, err)
+		}
+		if err := oprot.WriteFieldEnd(); err != nil {
+			return fmt.Errorf("%T write field end error 0:success: %s", p, err)
+		}
+		return nil
+	})
+}
+
+// TIntrospectionProcessor serves the introspection service for the services
+// registered on a TMultiplexedProcessor. It is registered on that same
+// processor, usually as INTROSPECTION_SERVICE_NAME:
+//
+//	processor := thrift.NewTMultiplexedProcessor()
+//	server := thrift.NewTSimpleServer4(processor, transport, transportFactory, protocolFactory)
+//	processor.RegisterProcessor(thrift.INTROSPECTION_SERVICE_NAME,
+//		thrift.NewTIntrospectionProcessor(processor, server, "1.2.3"))
+//
+// The services are listed at the time of each call, so services registered
+// later are reported as well.
+type TIntrospectionProcessor struct {
+	processorMap map[string]TProcessorFunction
+	processor    *TMultiplexedProcessor
+	server       TServer
+	version      string
+	startTime    time.Time
+}
+
+// NewTIntrospectionProcessor creates the introspection service for the
+// services of processor. server, which may be nil, provides the configured
+// factories, and version is the version of the application. The uptime is
+// counted from the creation of the TIntrospectionProcessor.
+func NewTIntrospectionProcessor(processor *TMultiplexedProcessor, server TServer, version string) *TIntrospectionProcessor {
+	p := &TIntrospectionProcessor{
+		processorMap: make(map[string]TProcessorFunction),
+		processor:    processor,
+		server:       server,
+		version:      version,
+		startTime:    time.Now(),
+	}
+	p.processorMap["describe"] = &tIntrospectionProcessorDescribe{p}
+	return p
+}
+
+func (p *TIntrospectionProcessor) AddToProcessorMap(key string, processor TProcessorFunction) {
+	p.processorMap[key] = processor
+}
+
+func (p *TIntrospectionProcessor) GetProcessorFunction(key string) (processor TProcessorFunction, ok bool) {
+	processor, ok = p.processorMap[key]
+	return processor, ok
+}
+
+func (p *TIntrospectionProcessor) ProcessorMap() map[string]TProcessorFunction {
+	return p.processorMap
+}
+
+func (p *TIntrospectionProcessor) Process(iprot, oprot TProtocol) (success bool, err TException) {
+	name, _, seqId, err := iprot.ReadMessageBegin()
+	if err != nil {
+		return false, err
+	}
+	if processor, ok := p.GetProcessorFunction(name); ok {
+		return processor.Process(seqId, iprot, oprot)
+	}
+	iprot.Skip(STRUCT)
+	iprot.ReadMessageEnd()
+	x := NewTApplicationException(UNKNOWN_METHOD, "Unknown function "+name)
+	oprot.WriteMessageBegin(name, EXCEPTION, seqId)
+	x.Write(oprot)
+	oprot.WriteMessageEnd()
+	oprot.Flush()
+	return false, x
+}
+
+// Describe returns the current description of the server.
+func (p *TIntrospectionProcessor) Describe() *TServerInfo {
+	now := time.Now()
+	info := &TServerInfo{
+		Version:        p.version,
+		LibraryVersion: Version,
+		StartTime:      p.startTime.UnixNano() / int64(time.Millisecond),
+		UptimeMillis:   int64(now.Sub(p.startTime) / time.Millisecond),
+		Services:       []*TServiceInfo{},
+	}
+	for _, name := range p.processor.Services() {
+		service := &TServiceInfo{Name: name, Methods: []string{}}
+		if processor, ok := p.processor.lookup(name); ok {
+			service.Methods = processorMethods(processor)
+		}
+		info.Services = append(info.Services, service)
+	}
+	if p.server != nil {
+		info.ServerTransport = typeName(p.server.ServerTransport())
+		info.InputTransportFactory = typeName(p.server.InputTransportFactory())
+		info.OutputTransportFactory = typeName(p.server.OutputTransportFactory())
+		info.InputProtocolFactory = typeName(p.server.InputProtocolFactory())
+		info.OutputProtocolFactory = typeName(p.server.OutputProtocolFactory())
+	}
+	return info
+}
+
+type tIntrospectionProcessorDescribe struct {
+	processor *TIntrospectionProcessor
+}
+
+func (p *tIntrospectionProcessorDescribe) Process(seqId int32, iprot, oprot TProtocol) (success bool, err TException) {
+	args := &tIntrospectionDescribeArgs{}
+	if err = args.Read(iprot); err != nil {
+		iprot.ReadMessageEnd()
+		x := NewTApplicationException(PROTOCOL_ERROR, err.Error())
+		oprot.WriteMessageBegin("describe", EXCEPTION, seqId)
+		x.Write(oprot)
+		oprot.WriteMessageEnd()
+		oprot.Flush()
+		return false, err
+	}
+	iprot.ReadMessageEnd()
+	result := &tIntrospectionDescribeResult{Success: p.processor.Describe()}
+	if err2 := oprot.WriteMessageBegin("describe", REPLY, seqId); err2 != nil {
+		err = err2
+	}
+	if err2 := result.Write(oprot); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 := oprot.WriteMessageEnd(); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 := oprot.Flush(); err == nil && err2 != nil {
+		err = err2
+	}
+	if err != nil {
+		return
+	}
+	return true, err
+}
+
+// TIntrospectionClient calls the introspection service through a TClient,
+// e.g. one returned by TMultiplexedConnection.Client.
+type TIntrospectionClient struct {
+	c TClient
+}
+
+func NewTIntrospectionClient(c TClient) *TIntrospectionClient {
+	return &TIntrospectionClient{c: c}
+}
+
+func (p *TIntrospectionClient) Describe() (*TServerInfo, error) {
+	result := &tIntrospectionDescribeResult{}
+	if err := p.c.Call("describe", &tIntrospectionDescribeArgs{}, result); err != nil {
+		return nil, err
+	}
+	if result.Success == nil {
+		return nil, NewTApplicationException(MISSING_RESULT, "describe failed: unknown result")
+	}
+	return result.Success, nil
+}
+
+// Returns the sorted method names of a processor exposing a ProcessorMap,
+// looking through processor middleware.
+func processorMethods(processor TProcessor) []string {
+	for {
+		wrapped, ok := processor.(*tWrappedProcessor)
+		if !ok {
+			break
+		}
+		processor = wrapped.processor
+	}
+	methods := []string{}
+	if p, ok := processor.(interface {
+		ProcessorMap() map[string]TProcessorFunction
+	}); ok {
+		for name := range p.ProcessorMap() {
+			methods = append(methods, name)
+		}
+		sort.Strings(methods)
+	}
+	return methods
+}
+
+func typeName(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func readIntrospectionStruct(p TStruct, iprot TProtocol, readField func(id int16, typeId TType) (bool, error)) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
+	}
+	for {
+		_, typeId, id, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, id, err)
+		}
+		if typeId == STOP {
+			break
+		}
+		ok, err := readField(id, typeId)
+		if err == nil && !ok {
+			err = iprot.Skip(typeId)
+		}
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, id, err)
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
+	}
+	return nil
+}
+
+func writeIntrospectionStruct(p TStruct, oprot TProtocol, name string, writeFields func() error) error {
+	if err := oprot.WriteStructBegin(name); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
+	}
+	if err := writeFields(); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
+	}
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
+	}
+	return nil
+}
+
+func writeIntrospectionString(oprot TProtocol, name string, id int16, value string) error {
+	if err := oprot.WriteFieldBegin(name, STRING, id); err != nil {
+		return fmt.Errorf("write field begin error %d:%s: %s", id, name, err)
+	}
+	if err := oprot.WriteString(value); err != nil {
+		return fmt.Errorf("field write error %d:%s: %s", id, name, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("write field end error %d:%s: %s", id, name, err)
+	}
+	return nil
+}
+
+func writeIntrospectionI64(oprot TProtocol, name string, id int16, value int64) error {
+	if err := oprot.WriteFieldBegin(name, I64, id); err != nil {
+		return fmt.Errorf("write field begin error %d:%s: %s", id, name, err)
+	}
+	if err := oprot.WriteI64(value); err != nil {
+		return fmt.Errorf("field write error %d:%s: %s", id, name, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("write field end error %d:%s: %s", id, name, err)
+	}
+	return nil
+}
+
+func writeIntrospectionStrings(oprot TProtocol, name string, id int16, values []string) error {
+	if err := oprot.WriteFieldBegin(name, LIST, id); err != nil {
+		return fmt.Errorf("write field begin error %d:%s: %s", id, name, err)
+	}
+	if err := oprot.WriteListBegin(STRING, len(values)); err != nil {
+		return fmt.Errorf("error writing list begin: %s", err)
+	}
+	for _, v := range values {
+		if err := oprot.WriteString(v); err != nil {
+			return fmt.Errorf("field write error %d:%s: %s", id, name, err)
+		}
+	}
+	if err := oprot.WriteListEnd(); err != nil {
+		return fmt.Errorf("error writing list end: %s", err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("write field end error %d:%s: %s", id, name, err)
+	}
+	return nil
+}
+
+func readIntrospectionStrings(iprot TProtocol) ([]string, error) {
+	_, size, err := iprot.ReadListBegin()
+	if err != nil {
+		return nil, fmt.Errorf("error reading list begin: %s", err)
+	}
+	values := make([]string, 0, size)
+	for i := 0; i < size; i++ {
+		v, err := iprot.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	if err := iprot.ReadListEnd(); err != nil {
+		return nil, fmt.Errorf("error reading list end: %s", err)
+	}
+	return values, nil
+}
+
+func readIntrospectionServices(iprot TProtocol) ([]*TServiceInfo, error) {
+	_, size, err := iprot.ReadListBegin()
+	if err != nil {
+		return nil, fmt.Errorf("error reading list begin: %s", err)
+	}
+	services := make([]*TServiceInfo, 0, size)
+	for i := 0; i < size; i++ {
+		service := NewTServiceInfo()
+		if err := service.Read(iprot); err != nil {
+			return nil, err
+		}
+		services = append(services, service)
+	}
+	if err := iprot.ReadListEnd(); err != nil {
+		return nil, fmt.Errorf("error reading list end: %s", err)
+	}
+	return services, nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIntrospectionProcessor(t *testing.T) {
+	processor := NewTMultiplexedProcessor()
+	processor.RegisterProcessor("Echo", &testEchoProcessor{})
+	trans := NewTLoopbackServerTransport()
+	server := NewTSimpleServer4(processor, trans, NewTFramedTransportFactory(NewTTransportFactory()), NewTCompactProtocolFactory())
+	server.SetLogger(NopLogger)
+	introspection := NewTIntrospectionProcessor(processor, server, "1.2.3")
+	processor.RegisterProcessor(INTROSPECTION_SERVICE_NAME, WrapProcessor(introspection))
+	trans.Listen()
+	go server.Serve()
+	defer server.Stop()
+	client := NewTFramedTransport(trans.Client(0))
+	if err := client.Open(); err != nil {
+		t.Fatalf("Unable to open client: %s", err)
+	}
+	defer client.Close()
+
+	conn := NewTMultiplexedConnection(client, NewTCompactProtocolFactory())
+	info, err := NewTIntrospectionClient(conn.Client(INTROSPECTION_SERVICE_NAME)).Describe()
+	if err != nil {
+		t.Fatalf("Describe failed: %s", err)
+	}
+	if info.Version != "1.2.3" || info.LibraryVersion != Version {
+		t.Errorf("Unexpected versions %q and %q", info.Version, info.LibraryVersion)
+	}
+	if info.StartTime <= 0 || info.UptimeMillis < 0 {
+		t.Errorf("Unexpected start time %d and uptime %d", info.StartTime, info.UptimeMillis)
+	}
+	expected := []*TServiceInfo{
+		{Name: "Echo", Methods: []string{}},
+		{Name: INTROSPECTION_SERVICE_NAME, Methods: []string{"describe"}},
+	}
+	if !reflect.DeepEqual(info.Services, expected) {
+		t.Errorf("Expected services %v, got %v", expected, info.Services)
+	}
+	if info.ServerTransport != "*thrift.TLoopbackServerTransport" ||
+		info.InputTransportFactory != "*thrift.tFramedTransportFactory" ||
+		info.OutputProtocolFactory != "*thrift.TCompactProtocolFactory" {
+		t.Errorf("Unexpected factories in %s", info)
+	}
+}
+
+func TestIntrospectionWithoutServer(t *testing.T) {
+	processor := NewTMultiplexedProcessor()
+	info := NewTIntrospectionProcessor(processor, nil, "").Describe()
+	if len(info.Services) != 0 || info.ServerTransport != "" || info.InputProtocolFactory != "" {
+		t.Fatalf("Unexpected description %s", info)
+	}
+
+	buf := NewTMemoryBuffer()
+	info.Services = []*TServiceInfo{{Name: "A", Methods: []string{"a", "b"}}}
+	info.InputProtocolFactory = "*thrift.TBinaryProtocolFactory"
+	if err := info.Write(NewTBinaryProtocolTransport(buf)); err != nil {
+		t.Fatal(err)
+	}
+	read := NewTServerInfo()
+	if err := read.Read(NewTBinaryProtocolTransport(buf)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, info) {
+		t.Fatalf("Expected %s, got %s", info, read)
+	}
+}
@@ -0,0 +1,614 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The status of responses carrying an exception declared by the method.
+const JSON_GATEWAY_EXCEPTION_STATUS = http.StatusUnprocessableEntity
+
+type tJSONGatewayMethod struct {
+	newArgs   func() TStruct
+	newResult func() TStruct
+}
+
+type tJSONGatewayService struct {
+	processor TProcessor
+	methods   map[string]tJSONGatewayMethod
+}
+
+// TJSONGateway is an http.Handler calling TProcessors with plain JSON.
+// A POST to /Service/method with a JSON object of the arguments, keyed by
+// their IDL names as in TSimpleJSONProtocol, is turned into a call of the
+// service's processor. The response is
+//
+//	200 with the JSON of the returned value, or 204 for void methods
+//	422 with {"<name>": <exception>} for an exception declared by the method
+//	400 for a body that does not match the arguments
+//	404 for an unknown service or method
+//	405 for methods other than POST
+//	500 with {"error": <message>, "type": <type>} for a TApplicationException
+//	500 with {"error": <message>} for a result JSON cannot represent, such
+//	    as a NaN or infinite double
+//
+// Binary values are unpadded base64 strings in responses, as written by
+// TJSONProtocol; padding is accepted in requests.
+//
+// The argument and result structs of every method are registered with
+// RegisterMethod, using their generated constructors.
+type TJSONGateway struct {
+	mu       sync.RWMutex
+	services map[string]*tJSONGatewayService
+	seqId    int32
+}
+
+func NewTJSONGateway() *TJSONGateway {
+	return &TJSONGateway{services: make(map[string]*tJSONGatewayService)}
+}
+
+// Registers the processor of a service, replacing any previous one. Its
+// methods are registered with RegisterMethod.
+func (p *TJSONGateway) RegisterProcessor(service string, processor TProcessor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok := p.services[service]; ok {
+		s.processor = processor
+		return
+	}
+	p.services[service] = &tJSONGatewayService{processor: processor, methods: make(map[string]tJSONGatewayMethod)}
+}
+
+// Makes a method of a registered service callable. newResult is nil for
+// oneway methods.
+//
+// Example:
+//
+//	gateway.RegisterMethod("Calculator", "add",
+//		func() thrift.TStruct { return tutorial.NewAddArgs() },
+//		func() thrift.TStruct { return tutorial.NewAddResult() })
+func (p *TJSONGateway) RegisterMethod(service, method string, newArgs func() TStruct, newResult func() TStruct) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.services[service]
+	if !ok {
+		return fmt.Errorf("Service %q has no registered processor", service)
+	}
+	s.methods[method] = tJSONGatewayMethod{newArgs, newResult}
+	return nil
+}
+
+func (p *TJSONGateway) lookup(service, method string) (TProcessor, tJSONGatewayMethod, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	s, ok := p.services[service]
+	if !ok {
+		return nil, tJSONGatewayMethod{}, false
+	}
+	m, ok := s.methods[method]
+	return s.processor, m, ok
+}
+
+func writeJSONGatewayResponse(w http.ResponseWriter, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		status = http.StatusInternalServerError
+		body, _ = json.Marshal(map[string]interface{}{"error": "Unable to encode the result: " + err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func writeJSONGatewayError(w http.ResponseWriter, status int, message string) {
+	writeJSONGatewayResponse(w, status, map[string]interface{}{"error": message})
+}
+
+func (p *TJSONGateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) != 2 {
+		writeJSONGatewayError(w, http.StatusNotFound, "Expected a path of the form /Service/method")
+		return
+	}
+	processor, method, ok := p.lookup(parts[0], parts[1])
+	if !ok {
+		writeJSONGatewayError(w, http.StatusNotFound, "Unknown method "+parts[0]+"."+parts[1])
+		return
+	}
+	if req.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSONGatewayError(w, http.StatusMethodNotAllowed, "Methods are called with POST")
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, DEFAULT_MAX_LENGTH))
+	if err != nil {
+		writeJSONGatewayError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	args := method.newArgs()
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := decodeJSONValue(body, reflect.ValueOf(args)); err != nil {
+			writeJSONGatewayError(w, http.StatusBadRequest, "Invalid arguments: "+err.Error())
+			return
+		}
+	}
+
+	// Call the processor through in-memory transports.
+	seqId := atomic.AddInt32(&p.seqId, 1)
+	call := NewTMemoryBuffer()
+	iprot := NewTBinaryProtocolTransport(call)
+	typeId := CALL
+	if method.newResult == nil {
+		typeId = ONEWAY
+	}
+	if err := iprot.WriteMessageBegin(parts[1], typeId, seqId); err == nil {
+		if err = args.Write(iprot); err == nil {
+			err = iprot.WriteMessageEnd()
+		}
+	}
+	if err != nil {
+		writeJSONGatewayError(w, http.StatusBadRequest, "Invalid arguments: "+err.Error())
+		return
+	}
+	reply := NewTMemoryBuffer()
+	oprot := NewTBinaryProtocolTransport(reply)
+	_, perr := processor.Process(iprot, oprot)
+	if reply.Len() == 0 {
+		if perr != nil {
+			writeJSONGatewayError(w, http.StatusInternalServerError, perr.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	_, replyType, _, err := oprot.ReadMessageBegin()
+	if err != nil {
+		writeJSONGatewayError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if replyType == EXCEPTION {
+		x, err := NewTApplicationException(UNKNOWN_APPLICATION_EXCEPTION, "").Read(oprot)
+		if err != nil {
+			writeJSONGatewayError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		status := http.StatusInternalServerError
+		if x.TypeId() == PROTOCOL_ERROR {
+			status = http.StatusBadRequest
+		}
+		writeJSONGatewayResponse(w, status, map[string]interface{}{"error": x.Error(), "type": x.TypeId()})
+		return
+	}
+	if method.newResult == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	result := method.newResult()
+	if err := result.Read(oprot); err != nil {
+		writeJSONGatewayError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	fields, err := encodeJSONValue(result)
+	if err != nil {
+		writeJSONGatewayError(w, http.StatusInternalServerError, "Unable to encode the result: "+err.Error())
+		return
+	}
+	// Declared exceptions are set next to a success value of a base type.
+	for name, value := range fields.(map[string]interface{}) {
+		if name != "success" {
+			writeJSONGatewayResponse(w, JSON_GATEWAY_EXCEPTION_STATUS, map[string]interface{}{name: value})
+			return
+		}
+	}
+	if success, ok := fields.(map[string]interface{})["success"]; ok {
+		writeJSONGatewayResponse(w, http.StatusOK, success)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// The IDL name of a struct field, from its thrift tag.
+func thriftFieldName(field reflect.StructField) string {
+	tag := field.Tag.Get("thrift")
+	if i := strings.Index(tag, ","); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// Decodes JSON into v. Structs are read by the names in their thrift tags,
+// sets (map[T]bool) from arrays of their members and binary values from
+// base64 strings, with or without padding.
+func decodeJSONValue(data []byte, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+			if v.CanSet() {
+				v.Set(reflect.Zero(v.Type()))
+			}
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeJSONValue(data, v.Elem())
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := thriftFieldName(t.Field(i))
+			if raw, ok := fields[name]; ok && name != "" {
+				if err := decodeJSONValue(raw, v.Field(i)); err != nil {
+					return fmt.Errorf("%s: %s", name, err)
+				}
+			}
+		}
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			var s string
+			if err := json.Unmarshal(data, &s); err != nil {
+				return err
+			}
+			b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+			if err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+		for i, elem := range elems {
+			if err := decodeJSONValue(elem, s.Index(i)); err != nil {
+				return fmt.Errorf("[%d]: %s", i, err)
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Map:
+		t := v.Type()
+		m := reflect.MakeMap(t)
+		if t.Elem().Kind() == reflect.Bool && bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			var elems []json.RawMessage
+			if err := json.Unmarshal(data, &elems); err != nil {
+				return err
+			}
+			for i, elem := range elems {
+				key := reflect.New(t.Key()).Elem()
+				if err := decodeJSONValue(elem, key); err != nil {
+					return fmt.Errorf("[%d]: %s", i, err)
+				}
+				m.SetMapIndex(key, reflect.ValueOf(true).Convert(t.Elem()))
+			}
+			v.Set(m)
+			return nil
+		}
+		var entries map[string]json.RawMessage
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return err
+		}
+		for k, raw := range entries {
+			key := reflect.New(t.Key()).Elem()
+			keyData := []byte(k)
+			if t.Key().Kind() == reflect.String {
+				keyData, _ = json.Marshal(k)
+			}
+			if err := decodeJSONValue(keyData, key); err != nil {
+				return fmt.Errorf("key %q: %s", k, err)
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := decodeJSONValue(raw, value); err != nil {
+				return fmt.Errorf("%q: %s", k, err)
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return nil
+	}
+	return json.Unmarshal(data, v.Addr().Interface())
+}
+
+// Encodes a struct as a value for encoding/json by writing it to a
+// tJSONValueProtocol.
+func encodeJSONValue(s TStruct) (interface{}, error) {
+	p := &tJSONValueProtocol{}
+	if err := s.Write(p); err != nil {
+		return nil, err
+	}
+	return p.value, nil
+}
+
+type tJSONValueContainer struct {
+	object map[string]interface{}
+	list   []interface{}
+	isMap  bool
+	key    *string
+	field  string
+}
+
+// A write-only TProtocol building the value written as maps, slices and
+// scalars for encoding/json. Structs become objects keyed by field name,
+// maps objects with their keys as strings, lists and sets arrays.
+type tJSONValueProtocol struct {
+	stack []*tJSONValueContainer
+	value interface{}
+}
+
+func (p *tJSONValueProtocol) push(c *tJSONValueContainer) error {
+	p.stack = append(p.stack, c)
+	return nil
+}
+
+func (p *tJSONValueProtocol) pop() error {
+	c := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	if c.object != nil {
+		return p.add(c.object)
+	}
+	if c.list == nil {
+		c.list = []interface{}{}
+	}
+	return p.add(c.list)
+}
+
+func (p *tJSONValueProtocol) add(value interface{}) error {
+	if len(p.stack) == 0 {
+		p.value = value
+		return nil
+	}
+	c := p.stack[len(p.stack)-1]
+	switch {
+	case c.isMap && c.key == nil:
+		key, err := jsonMapKey(value)
+		if err != nil {
+			return err
+		}
+		c.key = &key
+	case c.isMap:
+		c.object[*c.key] = value
+		c.key = nil
+	case c.object != nil:
+		c.object[c.field] = value
+	default:
+		c.list = append(c.list, value)
+	}
+	return nil
+}
+
+func jsonMapKey(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int8, int16, int32, int64, float64:
+		return fmt.Sprint(v), nil
+	}
+	key, err := json.Marshal(value)
+	return string(key), err
+}
+
+func (p *tJSONValueProtocol) WriteMessageBegin(name string, typeId TMessageType, seqid int32) error {
+	return nil
+}
+
+func (p *tJSONValueProtocol) WriteMessageEnd() error {
+	return nil
+}
+
+func (p *tJSONValueProtocol) WriteStructBegin(name string) error {
+	return p.push(&tJSONValueContainer{object: make(map[string]interface{})})
+}
+
+func (p *tJSONValueProtocol) WriteStructEnd() error {
+	return p.pop()
+}
+
+func (p *tJSONValueProtocol) WriteFieldBegin(name string, typeId TType, id int16) error {
+	p.stack[len(p.stack)-1].field = name
+	return nil
+}
+
+func (p *tJSONValueProtocol) WriteFieldEnd() error {
+	return nil
+}
+
+func (p *tJSONValueProtocol) WriteFieldStop() error {
+	return nil
+}
+
+func (p *tJSONValueProtocol) WriteMapBegin(keyType TType, valueType TType, size int) error {
+	return p.push(&tJSONValueContainer{object: make(map[string]interface{}, size), isMap: true})
+}
+
+func (p *tJSONValueProtocol) WriteMapEnd() error {
+	return p.pop()
+}
+
+func (p *tJSONValueProtocol) WriteListBegin(elemType TType, size int) error {
+	return p.push(&tJSONValueContainer{list: make([]interface{}, 0, size)})
+}
+
+func (p *tJSONValueProtocol) WriteListEnd() error {
+	return p.pop()
+}
+
+func (p *tJSONValueProtocol) WriteSetBegin(elemType TType, size int) error {
+	return p.push(&tJSONValueContainer{list: make([]interface{}, 0, size)})
+}
+
+func (p *tJSONValueProtocol) WriteSetEnd() error {
+	return p.pop()
+}
+
+func (p *tJSONValueProtocol) WriteBool(value bool) error {
+	return p.add(value)
+}
+
+func (p *tJSONValueProtocol) WriteByte(value byte) error {
+	return p.add(int8(value))
+}
+
+func (p *tJSONValueProtocol) WriteI16(value int16) error {
+	return p.add(value)
+}
+
+func (p *tJSONValueProtocol) WriteI32(value int32) error {
+	return p.add(value)
+}
+
+func (p *tJSONValueProtocol) WriteI64(value int64) error {
+	return p.add(value)
+}
+
+// JSON has no representation for NaN and infinities, which TJSONProtocol
+// writes as strings. They are rejected rather than returned as strings
+// callers would have to tell apart from numbers.
+func (p *tJSONValueProtocol) WriteDouble(value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return NewTProtocolExceptionWithType(INVALID_DATA, fmt.Errorf("Double %v cannot be encoded in JSON", value))
+	}
+	return p.add(value)
+}
+
+func (p *tJSONValueProtocol) WriteString(value string) error {
+	return p.add(value)
+}
+
+// Binary values are written as unpadded base64, as by TJSONProtocol.
+func (p *tJSONValueProtocol) WriteBinary(value []byte) error {
+	return p.add(base64.RawStdEncoding.EncodeToString(value))
+}
+
+var errJSONValueRead = NewTProtocolExceptionWithType(NOT_IMPLEMENTED, fmt.Errorf("JSON values are write-only"))
+
+func (p *tJSONValueProtocol) ReadMessageBegin() (string, TMessageType, int32, error) {
+	return "", 0, 0, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadMessageEnd() error {
+	return errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadStructBegin() (string, error) {
+	return "", errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadStructEnd() error {
+	return errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadFieldBegin() (string, TType, int16, error) {
+	return "", STOP, 0, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadFieldEnd() error {
+	return errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadMapBegin() (TType, TType, int, error) {
+	return STOP, STOP, 0, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadMapEnd() error {
+	return errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadListBegin() (TType, int, error) {
+	return STOP, 0, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadListEnd() error {
+	return errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadSetBegin() (TType, int, error) {
+	return STOP, 0, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadSetEnd() error {
+	return errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadBool() (bool, error) {
+	return false, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadByte() (byte, error) {
+	return 0, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadI16() (int16, error) {
+	return 0, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadI32() (int32, error) {
+	return 0, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadI64() (int64, error) {
+	return 0, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadDouble() (float64, error) {
+	return 0, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadString() (string, error) {
+	return "", errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) ReadBinary() ([]byte, error) {
+	return nil, errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) Skip(fieldType TType) error {
+	return errJSONValueRead
+}
+
+func (p *tJSONValueProtocol) Flush() error {
+	return nil
+}
+
+func (p *tJSONValueProtocol) Transport() TTransport {
+	return nil
+}
@@ -0,0 +1,369 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testGatewayError struct {
+	Why string `thrift:"why,1"`
+}
+
+func (p *testGatewayError) Error() string {
+	return p.Why
+}
+
+func (p *testGatewayError) Read(iprot TProtocol) error {
+	return readTestGatewayStruct(iprot, func(id int16, typeId TType) (bool, error) {
+		if id != 1 || typeId != STRING {
+			return false, nil
+		}
+		var err error
+		p.Why, err = iprot.ReadString()
+		return true, err
+	})
+}
+
+func (p *testGatewayError) Write(oprot TProtocol) error {
+	return writeTestGatewayStruct(oprot, "testGatewayError", func() error {
+		if err := oprot.WriteFieldBegin("why", STRING, 1); err != nil {
+			return err
+		}
+		if err := oprot.WriteString(p.Why); err != nil {
+			return err
+		}
+		return oprot.WriteFieldEnd()
+	})
+}
+
+// The arguments of the echo and notify methods, shaped like generated code.
+type testGatewayArgs struct {
+	S    *TestStruct `thrift:"s,1"`
+	Fail string      `thrift:"fail,2"`
+}
+
+func (p *testGatewayArgs) Read(iprot TProtocol) error {
+	return readTestGatewayStruct(iprot, func(id int16, typeId TType) (bool, error) {
+		switch {
+		case id == 1 && typeId == STRUCT:
+			p.S = NewTestStruct()
+			return true, p.S.Read(iprot)
+		case id == 2 && typeId == STRING:
+			var err error
+			p.Fail, err = iprot.ReadString()
+			return true, err
+		}
+		return false, nil
+	})
+}
+
+func (p *testGatewayArgs) Write(oprot TProtocol) error {
+	return writeTestGatewayStruct(oprot, "testGatewayArgs", func() error {
+		if p.S != nil {
+			if err := oprot.WriteFieldBegin("s", STRUCT, 1); err != nil {
+				return err
+			}
+			if err := p.S.Write(oprot); err != nil {
+				return err
+			}
+			if err := oprot.WriteFieldEnd(); err != nil {
+				return err
+			}
+		}
+		if err := oprot.WriteFieldBegin("fail", STRING, 2); err != nil {
+			return err
+		}
+		if err := oprot.WriteString(p.Fail); err != nil {
+			return err
+		}
+		return oprot.WriteFieldEnd()
+	})
+}
+
+type testGatewayResult struct {
+	Success *TestStruct       `thrift:"success,0"`
+	Ouch    *testGatewayError `thrift:"ouch,1"`
+}
+
+func (p *testGatewayResult) Read(iprot TProtocol) error {
+	return readTestGatewayStruct(iprot, func(id int16, typeId TType) (bool, error) {
+		switch {
+		case id == 0 && typeId == STRUCT:
+			p.Success = NewTestStruct()
+			return true, p.Success.Read(iprot)
+		case id == 1 && typeId == STRUCT:
+			p.Ouch = &testGatewayError{}
+			return true, p.Ouch.Read(iprot)
+		}
+		return false, nil
+	})
+}
+
+func (p *testGatewayResult) Write(oprot TProtocol) error {
+	return writeTestGatewayStruct(oprot, "testGatewayResult", func() error {
+		if p.Success != nil {
+			if err := oprot.WriteFieldBegin("success", STRUCT, 0); err != nil {
+				return err
+			}
+			if err := p.Success.Write(oprot); err != nil {
+				return err
+			}
+			if err := oprot.WriteFieldEnd(); err != nil {
+				return err
+			}
+		}
+		if p.Ouch != nil {
+			if err := oprot.WriteFieldBegin("ouch", STRUCT, 1); err != nil {
+				return err
+			}
+			if err := p.Ouch.Write(oprot); err != nil {
+				return err
+			}
+			return oprot.WriteFieldEnd()
+		}
+		return nil
+	})
+}
+
+func readTestGatewayStruct(iprot TProtocol, readField func(id int16, typeId TType) (bool, error)) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return err
+	}
+	for {
+		_, typeId, id, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if typeId == STOP {
+			break
+		}
+		read, err := readField(id, typeId)
+		if err != nil {
+			return err
+		}
+		if !read {
+			if err := iprot.Skip(typeId); err != nil {
+				return err
+			}
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	return iprot.ReadStructEnd()
+}
+
+func writeTestGatewayStruct(oprot TProtocol, name string, writeFields func() error) error {
+	if err := oprot.WriteStructBegin(name); err != nil {
+		return err
+	}
+	if err := writeFields(); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return err
+	}
+	return oprot.WriteStructEnd()
+}
+
+// Processor answering echo with its argument, or failing as asked, and
+// accepting notify as a oneway call.
+type testGatewayProcessor struct {
+	notified chan *TestStruct
+}
+
+func (p *testGatewayProcessor) Process(in, out TProtocol) (bool, TException) {
+	name, _, seqId, err := in.ReadMessageBegin()
+	if err != nil {
+		return false, err
+	}
+	args := &testGatewayArgs{}
+	if name != "echo" && name != "notify" {
+		in.Skip(STRUCT)
+		in.ReadMessageEnd()
+		x := NewTApplicationException(UNKNOWN_METHOD, "Unknown function "+name)
+		out.WriteMessageBegin(name, EXCEPTION, seqId)
+		x.Write(out)
+		out.WriteMessageEnd()
+		return false, x
+	}
+	if err := args.Read(in); err != nil {
+		return false, err
+	}
+	in.ReadMessageEnd()
+	if name == "notify" {
+		p.notified <- args.S
+		return true, nil
+	}
+	result := &testGatewayResult{}
+	switch args.Fail {
+	case "declared":
+		result.Ouch = &testGatewayError{"declared failure"}
+	case "nan":
+		result.Success = &TestStruct{D: math.Inf(1)}
+	case "internal":
+		x := NewTApplicationException(INTERNAL_ERROR, "Internal error processing echo")
+		out.WriteMessageBegin(name, EXCEPTION, seqId)
+		x.Write(out)
+		out.WriteMessageEnd()
+		return true, nil
+	default:
+		result.Success = args.S
+	}
+	out.WriteMessageBegin(name, REPLY, seqId)
+	result.Write(out)
+	out.WriteMessageEnd()
+	return true, out.Flush()
+}
+
+func newTestJSONGateway(t *testing.T) (*httptest.Server, *testGatewayProcessor) {
+	processor := &testGatewayProcessor{notified: make(chan *TestStruct, 1)}
+	gateway := NewTJSONGateway()
+	gateway.RegisterProcessor("Test", processor)
+	newArgs := func() TStruct { return &testGatewayArgs{} }
+	newResult := func() TStruct { return &testGatewayResult{} }
+	for method, newResult := range map[string]func() TStruct{"echo": newResult, "notify": nil, "missing": newResult} {
+		if err := gateway.RegisterMethod("Test", method, newArgs, newResult); err != nil {
+			t.Fatalf("Unable to register %s: %s", method, err)
+		}
+	}
+	if err := gateway.RegisterMethod("Other", "echo", newArgs, newResult); err == nil {
+		t.Fatal("Expected an error registering a method of an unknown service")
+	}
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+	return server, processor
+}
+
+func postTestGateway(t *testing.T, url, body string) (int, []byte) {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+const testGatewayStructJSON = `{"on":true,"b":-1,"int16":-2,"int32":300,"int64":-1099511627776,"d":3.5,` +
+	`"st":"fuzz \"me\"","bin":"AAH/","stringMap":{"k":"v"},"stringList":["a","b"],"stringSet":["s"],"e":3}`
+
+func TestJSONGatewayCall(t *testing.T) {
+	server, _ := newTestJSONGateway(t)
+	status, body := postTestGateway(t, server.URL+"/Test/echo", `{"s":`+testGatewayStructJSON+`,"unknown":1}`)
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", status, body)
+	}
+	var got, expected interface{}
+	json.Unmarshal(body, &got)
+	json.Unmarshal([]byte(testGatewayStructJSON), &expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %s, got %s", testGatewayStructJSON, body)
+	}
+}
+
+func TestJSONGatewayDecode(t *testing.T) {
+	args := &testGatewayArgs{}
+	if err := decodeJSONValue([]byte(`{"s":`+testGatewayStructJSON+`}`), reflect.ValueOf(args)); err != nil {
+		t.Fatalf("Unable to decode: %s", err)
+	}
+	if !reflect.DeepEqual(args.S, fuzzTestStruct()) {
+		t.Fatalf("Expected %v, got %v", fuzzTestStruct(), args.S)
+	}
+	s := NewTestStruct()
+	if err := decodeJSONValue([]byte(`{"stringSet":{"x":true},"bin":"AAH/AA=="}`), reflect.ValueOf(s)); err != nil {
+		t.Fatalf("Unable to decode: %s", err)
+	}
+	if !s.StringSet["x"] || !bytes.Equal(s.Bin, []byte{0, 1, 0xff, 0}) {
+		t.Fatalf("Unexpected set or binary %v %v", s.StringSet, s.Bin)
+	}
+}
+
+// Binary values are written unpadded, like TJSONProtocol does, and read
+// back with or without padding.
+func TestJSONGatewayBinary(t *testing.T) {
+	value, err := encodeJSONValue(&TestStruct{Bin: []byte{0, 1, 0xff, 0}})
+	if err != nil {
+		t.Fatalf("Unable to encode: %s", err)
+	}
+	bin := value.(map[string]interface{})["bin"]
+	if bin != "AAH/AA" {
+		t.Fatalf("Expected unpadded base64 AAH/AA, got %v", bin)
+	}
+	for _, data := range []string{`{"bin":"AAH/AA"}`, `{"bin":"AAH/AA=="}`} {
+		s := NewTestStruct()
+		if err := decodeJSONValue([]byte(data), reflect.ValueOf(s)); err != nil || !bytes.Equal(s.Bin, []byte{0, 1, 0xff, 0}) {
+			t.Fatalf("%s: expected [0 1 255 0], got %v and %v", data, s.Bin, err)
+		}
+	}
+}
+
+func TestJSONGatewayErrors(t *testing.T) {
+	server, _ := newTestJSONGateway(t)
+	for _, c := range []struct {
+		path, body string
+		status     int
+		contains   string
+	}{
+		{"/Test/echo", `{"fail":"declared"}`, JSON_GATEWAY_EXCEPTION_STATUS, `{"ouch":{"why":"declared failure"}}`},
+		{"/Test/echo", `{"fail":"internal"}`, http.StatusInternalServerError, `"type":6`},
+		{"/Test/echo", `{"fail":"nan"}`, http.StatusInternalServerError, `Double +Inf cannot be encoded in JSON`},
+		{"/Test/missing", `{}`, http.StatusInternalServerError, `"type":1`},
+		{"/Test/echo", `{"s":{"int32":"x"}}`, http.StatusBadRequest, `s: `},
+		{"/Test/echo", `{"s":`, http.StatusBadRequest, `"error"`},
+		{"/Test/unknown", `{}`, http.StatusNotFound, `"error"`},
+		{"/Unknown/echo", `{}`, http.StatusNotFound, `"error"`},
+		{"/Test", `{}`, http.StatusNotFound, `"error"`},
+	} {
+		status, body := postTestGateway(t, server.URL+c.path, c.body)
+		if status != c.status || !strings.Contains(string(body), c.contains) {
+			t.Errorf("%s %s: expected %d with %s, got %d: %s", c.path, c.body, c.status, c.contains, status, body)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/Test/echo")
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "POST" {
+		t.Fatalf("Expected 405 allowing POST, got %d", resp.StatusCode)
+	}
+}
+
+func TestJSONGatewayOneway(t *testing.T) {
+	server, processor := newTestJSONGateway(t)
+	status, body := postTestGateway(t, server.URL+"/Test/notify", `{"s":{"st":"hello"}}`)
+	if status != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", status, body)
+	}
+	if s := <-processor.notified; s.St != "hello" {
+		t.Fatalf("Unexpected notification %v", s)
+	}
+}
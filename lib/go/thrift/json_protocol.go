@@ -134,10 +134,17 @@ func (p *TJSONProtocol) WriteMapBegin(keyType TType, valueType TType, size int)
 	if e := p.WriteString(s); e != nil {
 		return e
 	}
-	return p.WriteI64(int64(size))
+	if e := p.WriteI64(int64(size)); e != nil {
+		return e
+	}
+	// the entries are written as an object keyed by the map keys
+	return p.OutputObjectBegin()
 }
 
 func (p *TJSONProtocol) WriteMapEnd() error {
+	if e := p.OutputObjectEnd(); e != nil {
+		return e
+	}
 	return p.OutputListEnd()
 }
 
@@ -167,7 +174,8 @@ func (p *TJSONProtocol) WriteBool(b bool) error {
 }
 
 func (p *TJSONProtocol) WriteByte(b byte) error {
-	return p.WriteI32(int32(b))
+	// Thrift bytes are signed
+	return p.WriteI32(int32(int8(b)))
 }
 
 func (p *TJSONProtocol) WriteI16(v int16) error {
@@ -199,7 +207,8 @@ func (p *TJSONProtocol) WriteBinary(v []byte) error {
 		return e
 	}
 	p.writer.Write(JSON_QUOTE_BYTES)
-	writer := base64.NewEncoder(base64.StdEncoding, p.writer)
+	// without padding, like the other Thrift libraries
+	writer := base64.NewEncoder(base64.RawStdEncoding, p.writer)
 	if _, e := writer.Write(v); e != nil {
 		return NewTProtocolException(e)
 	}
@@ -306,10 +315,20 @@ func (p *TJSONProtocol) ReadMapBegin() (keyType TType, valueType TType, size int
 	// read size
 	iSize, err := p.ReadI64()
 	size = int(iSize)
+	if err == nil {
+		err = p.checkContainerSize(size)
+	}
+	if err != nil {
+		return keyType, valueType, size, err
+	}
+	_, err = p.ParseObjectStart()
 	return keyType, valueType, size, err
 }
 
 func (p *TJSONProtocol) ReadMapEnd() error {
+	if err := p.ParseObjectEnd(); err != nil {
+		return err
+	}
 	return p.ParseListEnd()
 }
 
@@ -456,6 +475,9 @@ func (p *TJSONProtocol) ParseElemListBegin() (elemType TType, size int, e error)
 	}
 	nSize, err2 := p.ReadI64()
 	size = int(nSize)
+	if err2 == nil {
+		err2 = p.checkContainerSize(size)
+	}
 	return elemType, size, err2
 }
 
@@ -473,6 +495,9 @@ func (p *TJSONProtocol) readElemListBegin() (elemType TType, size int, e error)
 	}
 	nSize, err2 := p.ReadI64()
 	size = int(nSize)
+	if err2 == nil {
+		err2 = p.checkContainerSize(size)
+	}
 	return elemType, size, err2
 }
 
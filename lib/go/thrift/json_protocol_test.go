@@ -98,11 +98,12 @@ func TestWriteJSONProtocolByte(t *testing.T) {
 			t.Fatalf("Unable to write %s value %v due to error flushing: %s", thetype, value, e.Error())
 		}
 		s := trans.String()
-		if s != fmt.Sprint(value) {
+		// bytes are signed on the wire
+		if s != fmt.Sprint(int8(value)) {
 			t.Fatalf("Bad value for %s %v: %s", thetype, value, s)
 		}
-		v := byte(0)
-		if err := json.Unmarshal([]byte(s), &v); err != nil || v != value {
+		v := int8(0)
+		if err := json.Unmarshal([]byte(s), &v); err != nil || byte(v) != value {
 			t.Fatalf("Bad json-decoded value for %s %v, wrote: '%s', expected: '%v'", thetype, value, s, v)
 		}
 		trans.Reset()
@@ -401,8 +402,8 @@ func TestReadJSONProtocolString(t *testing.T) {
 func TestWriteJSONProtocolBinary(t *testing.T) {
 	thetype := "binary"
 	value := protocol_bdata
-	b64value := make([]byte, base64.StdEncoding.EncodedLen(len(protocol_bdata)))
-	base64.StdEncoding.Encode(b64value, value)
+	b64value := make([]byte, base64.RawStdEncoding.EncodedLen(len(protocol_bdata)))
+	base64.RawStdEncoding.Encode(b64value, value)
 	b64String := string(b64value)
 	trans := NewTMemoryBuffer()
 	p := NewTJSONProtocol(trans)
@@ -0,0 +1,43 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"log"
+)
+
+// Logger is the pluggable logging hook used by servers and middleware.
+type Logger func(msg string)
+
+// StdLogger returns a Logger that writes to the given *log.Logger, or to
+// the standard logger if l is nil.
+func StdLogger(l *log.Logger) Logger {
+	if l == nil {
+		return func(msg string) {
+			log.Println(msg)
+		}
+	}
+	return func(msg string) {
+		l.Println(msg)
+	}
+}
+
+// NopLogger discards all messages.
+func NopLogger(msg string) {}
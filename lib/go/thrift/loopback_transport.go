@@ -0,0 +1,173 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// TLoopbackServerTransport is an in-process TServerTransport. Clients
+// created by Client connect to it through in-memory pipes, so a TServer and
+// its clients can run in a single process without binding a port, with the
+// usual transport and protocol factories on top.
+type TLoopbackServerTransport struct {
+	mu          sync.Mutex
+	conns       chan net.Conn
+	interrupted chan struct{}
+	listening   bool
+}
+
+func NewTLoopbackServerTransport() *TLoopbackServerTransport {
+	return &TLoopbackServerTransport{conns: make(chan net.Conn), interrupted: make(chan struct{})}
+}
+
+func (p *TLoopbackServerTransport) Listen() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.listening {
+		p.listening = true
+		p.interrupted = make(chan struct{})
+	}
+	return nil
+}
+
+// Returns the channel closed by the next Close, and whether the transport
+// is listening.
+func (p *TLoopbackServerTransport) stopped() (chan struct{}, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.interrupted, p.listening
+}
+
+func (p *TLoopbackServerTransport) Accept() (TTransport, error) {
+	interrupted, listening := p.stopped()
+	if !listening {
+		return nil, NewTTransportException(NOT_OPEN, "Loopback server transport not listening")
+	}
+	select {
+	case conn := <-p.conns:
+		return NewTSocketFromConnTimeout(conn, 0), nil
+	case <-interrupted:
+		return nil, errTransportInterrupted
+	}
+}
+
+func (p *TLoopbackServerTransport) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listening {
+		p.listening = false
+		close(p.interrupted)
+	}
+	return nil
+}
+
+// Interrupt stops listening and unblocks any pending Accept.
+func (p *TLoopbackServerTransport) Interrupt() error {
+	return p.Close()
+}
+
+// Hands a new connection to Accept and returns the client end of it.
+func (p *TLoopbackServerTransport) dial() (net.Conn, error) {
+	interrupted, listening := p.stopped()
+	if !listening {
+		return nil, NewTTransportException(NOT_OPEN, "Loopback server transport not listening")
+	}
+	server, client := net.Pipe()
+	select {
+	case p.conns <- server:
+		return client, nil
+	case <-interrupted:
+		server.Close()
+		client.Close()
+		return nil, NewTTransportException(NOT_OPEN, "Loopback server transport closed")
+	}
+}
+
+// Client returns an unopened client transport that connects to this server
+// transport when opened. timeout applies to reads and writes, as for
+// TSocket.
+func (p *TLoopbackServerTransport) Client(timeout time.Duration) *TLoopbackTransport {
+	return &TLoopbackTransport{server: p, timeout: timeout}
+}
+
+// TLoopbackTransport is the client side of a TLoopbackServerTransport.
+type TLoopbackTransport struct {
+	server  *TLoopbackServerTransport
+	timeout time.Duration
+	socket  *TSocket
+}
+
+func (p *TLoopbackTransport) Open() error {
+	if p.IsOpen() {
+		return NewTTransportException(ALREADY_OPEN, "Loopback transport already connected.")
+	}
+	conn, err := p.server.dial()
+	if err != nil {
+		return err
+	}
+	p.socket = NewTSocketFromConnTimeout(conn, p.timeout)
+	return nil
+}
+
+func (p *TLoopbackTransport) IsOpen() bool {
+	return p.socket != nil && p.socket.IsOpen()
+}
+
+func (p *TLoopbackTransport) Close() error {
+	if p.socket == nil {
+		return nil
+	}
+	err := p.socket.Close()
+	p.socket = nil
+	return err
+}
+
+func (p *TLoopbackTransport) Read(buf []byte) (int, error) {
+	if !p.IsOpen() {
+		return 0, NewTTransportException(NOT_OPEN, "Connection not open")
+	}
+	return p.socket.Read(buf)
+}
+
+func (p *TLoopbackTransport) Write(buf []byte) (int, error) {
+	if !p.IsOpen() {
+		return 0, NewTTransportException(NOT_OPEN, "Connection not open")
+	}
+	return p.socket.Write(buf)
+}
+
+func (p *TLoopbackTransport) Flush() error {
+	return nil
+}
+
+func (p *TLoopbackTransport) Peek() bool {
+	return p.IsOpen()
+}
+
+// Retreive the underlying net.Conn
+func (p *TLoopbackTransport) Conn() net.Conn {
+	if p.socket == nil {
+		return nil
+	}
+	return p.socket.Conn()
+}
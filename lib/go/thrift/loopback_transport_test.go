@@ -0,0 +1,119 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLoopbackTransport(t *testing.T) {
+	server := NewTLoopbackServerTransport()
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen() failed: %s", err)
+	}
+	defer server.Close()
+	accepted := make(chan TTransport, 1)
+	go func() {
+		trans, _ := server.Accept()
+		accepted <- trans
+	}()
+	client := server.Client(time.Second)
+	if err := client.Open(); err != nil {
+		t.Fatalf("Open() failed: %s", err)
+	}
+	defer client.Close()
+	serverSide := <-accepted
+	if serverSide == nil {
+		t.Fatalf("Accept() failed")
+	}
+	defer serverSide.Close()
+	// Pipes are synchronous, so write from a goroutine.
+	go func() {
+		client.Write(transport_bdata)
+		client.Flush()
+	}()
+	buf := make([]byte, len(transport_bdata))
+	if _, err := io.ReadFull(serverSide, buf); err != nil {
+		t.Fatalf("Unable to read from accepted transport: %s", err)
+	}
+	if !bytes.Equal(buf, transport_bdata) {
+		t.Fatalf("Accepted transport read unexpected data")
+	}
+}
+
+func TestLoopbackServerTransportInterrupt(t *testing.T) {
+	server := NewTLoopbackServerTransport()
+	if _, err := server.Accept(); err == nil {
+		t.Fatalf("Expected Accept() to fail before Listen()")
+	}
+	server.Listen()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		server.Interrupt()
+	}()
+	if _, err := server.Accept(); err == nil {
+		t.Fatalf("Expected Accept() to be interrupted")
+	}
+	if err := server.Client(0).Open(); err == nil {
+		t.Fatalf("Expected Open() to fail once the server is closed")
+	}
+}
+
+func TestSimpleServerLoopback(t *testing.T) {
+	transportFactory := NewTFramedTransportFactory(NewTTransportFactory())
+	protocolFactory := NewTCompactProtocolFactory()
+	serverTransport := NewTLoopbackServerTransport()
+	server := NewTSimpleServer4(&testEchoProcessor{}, serverTransport, transportFactory, protocolFactory)
+	server.SetLogger(NopLogger)
+	handler := &testEventHandler{}
+	server.SetServerEventHandler(handler)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve() }()
+
+	trans := transportFactory.GetTransport(serverTransport.Client(time.Second))
+	// The server may still be starting up.
+	for i := 0; trans.Open() != nil; i++ {
+		if i == 100 {
+			t.Fatalf("Unable to connect to the loopback server")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	defer trans.Close()
+	client := NewTStandardClient(protocolFactory.GetProtocol(trans), protocolFactory.GetProtocol(trans))
+	for i := int32(0); i < 3; i++ {
+		result := &testCallStruct{}
+		if err := client.Call("echo", &testCallStruct{i}, result); err != nil {
+			t.Fatalf("Call() failed: %s", err)
+		}
+		if result.Value != i {
+			t.Fatalf("Expected %d but got %d", i, result.Value)
+		}
+	}
+	server.Stop()
+	if err := <-served; err != nil {
+		t.Fatalf("Serve() failed: %s", err)
+	}
+	if events := handler.recorded(); len(events) == 0 || events[0] != "PreServe" {
+		t.Fatalf("Expected PreServe to be called first, got %v", events)
+	}
+}
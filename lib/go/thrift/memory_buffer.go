@@ -81,3 +81,7 @@ func (p *TMemoryBuffer) Close() error {
 func (p *TMemoryBuffer) Flush() error {
 	return nil
 }
+
+func (p *TMemoryBuffer) remainingBytes() int {
+	return p.Len()
+}
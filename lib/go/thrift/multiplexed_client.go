@@ -0,0 +1,378 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"sync"
+)
+
+// TMultiplexedConnection shares one connection to a TMultiplexedProcessor
+// between the clients of several services. Calls made through its clients
+// may come from any number of goroutines; each call holds the connection
+// from sending the request until its reply has been read.
+//
+// A call that fails in the middle of a message closes the transport, as the
+// rest of the message would be taken for the reply to the next call. Later
+// calls fail with NOT_OPEN until the application reopens it through
+// Transport.
+//
+// Example, with generated clients:
+//
+//	conn := thrift.NewTMultiplexedConnection(transport, thrift.NewTBinaryProtocolFactoryDefault())
+//	calculator := tutorial.NewCalculatorClientFactory(conn.Transport(), conn.ProtocolFactory("Calculator"))
+//	weather := forecast.NewWeatherReportClientFactory(conn.Transport(), conn.ProtocolFactory("WeatherReport"))
+type TMultiplexedConnection struct {
+	mu     sync.Mutex
+	trans  TTransport
+	iprot  TProtocol
+	client *TStandardClient
+	seqId  int32
+
+	// The call of a generated client holding mu, if any.
+	held   bool
+	name   string
+	seqid  int32
+	oneway bool
+}
+
+// Creates a TMultiplexedConnection over an opened transport.
+func NewTMultiplexedConnection(trans TTransport, protocolFactory TProtocolFactory) *TMultiplexedConnection {
+	iprot := protocolFactory.GetProtocol(trans)
+	return &TMultiplexedConnection{
+		trans:  trans,
+		iprot:  iprot,
+		client: NewTStandardClient(iprot, iprot),
+	}
+}
+
+// Returns the TClient of the service serviceName.
+func (c *TMultiplexedConnection) Client(serviceName string) TClient {
+	return &tMultiplexedClient{conn: c, oprot: NewTMultiplexedProtocolFromProtocol(c.iprot, serviceName)}
+}
+
+// Returns a protocol factory for the generated client of the service
+// serviceName, to be passed with Transport to its New<Service>ClientFactory.
+// The protocols it returns ignore the transport they are created for and
+// use the shared connection, which a call holds from writing its request
+// until its reply has been read, or its oneway request has been flushed.
+func (c *TMultiplexedConnection) ProtocolFactory(serviceName string) TProtocolFactory {
+	return &tSharedConnectionProtocolFactory{conn: c, serviceName: serviceName}
+}
+
+// Returns the underlying transport.
+func (c *TMultiplexedConnection) Transport() TTransport {
+	return c.trans
+}
+
+// Closes the underlying transport, waiting for the current call to finish.
+func (c *TMultiplexedConnection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.trans.Close()
+}
+
+func (c *TMultiplexedConnection) call(oprot TProtocol, method string, args, result TStruct) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seqId++
+	seqId := c.seqId
+	err := c.client.Send(oprot, seqId, method, args, result == nil)
+	if err == nil && result != nil {
+		err = c.client.Recv(c.iprot, seqId, method, result)
+	}
+	if err != nil && !isCompleteReply(err) {
+		// Part of a message may be left on the connection, which would be
+		// taken for the reply to the next call.
+		c.trans.Close()
+	}
+	return err
+}
+
+// Whether err was read as an EXCEPTION reply to the call, leaving the
+// connection at a message boundary and in step with the calls.
+func isCompleteReply(err error) bool {
+	x, ok := err.(TApplicationException)
+	if !ok {
+		return false
+	}
+	switch x.TypeId() {
+	case WRONG_METHOD_NAME, BAD_SEQUENCE_ID, INVALID_MESSAGE_TYPE_EXCEPTION:
+		return false
+	}
+	return true
+}
+
+type tMultiplexedClient struct {
+	conn  *TMultiplexedConnection
+	oprot TProtocol
+}
+
+func (p *tMultiplexedClient) Call(method string, args, result TStruct) error {
+	return p.conn.call(p.oprot, method, args, result)
+}
+
+// Starts a call of a generated client.
+func (c *TMultiplexedConnection) hold(name string, typeId TMessageType, seqid int32) {
+	c.mu.Lock()
+	c.held, c.name, c.seqid, c.oneway = true, name, seqid, typeId == ONEWAY
+}
+
+// Ends the call of a generated client.
+func (c *TMultiplexedConnection) release() {
+	if c.held {
+		c.held = false
+		c.mu.Unlock()
+	}
+}
+
+// Ends the call of a generated client that failed with err, closing the
+// transport since the call may have stopped in the middle of a message.
+func (c *TMultiplexedConnection) fail(err error) error {
+	if err != nil && c.held {
+		c.trans.Close()
+		c.release()
+	}
+	return err
+}
+
+type tSharedConnectionProtocolFactory struct {
+	conn        *TMultiplexedConnection
+	serviceName string
+}
+
+func (f *tSharedConnectionProtocolFactory) GetProtocol(trans TTransport) TProtocol {
+	return &tSharedConnectionProtocol{
+		conn:  f.conn,
+		proto: NewTMultiplexedProtocolFromProtocol(f.conn.iprot, f.serviceName),
+	}
+}
+
+// Protocol of a generated client on a TMultiplexedConnection, holding the
+// connection for the duration of each call.
+type tSharedConnectionProtocol struct {
+	conn  *TMultiplexedConnection
+	proto TProtocol
+}
+
+func (p *tSharedConnectionProtocol) WriteMessageBegin(name string, typeId TMessageType, seqid int32) error {
+	p.conn.hold(name, typeId, seqid)
+	return p.conn.fail(p.proto.WriteMessageBegin(name, typeId, seqid))
+}
+
+func (p *tSharedConnectionProtocol) Flush() error {
+	if err := p.proto.Flush(); err != nil {
+		return p.conn.fail(err)
+	}
+	if p.conn.oneway {
+		p.conn.release()
+	}
+	return nil
+}
+
+func (p *tSharedConnectionProtocol) ReadMessageBegin() (name string, typeId TMessageType, seqid int32, err error) {
+	name, typeId, seqid, err = p.proto.ReadMessageBegin()
+	if err == nil && name != p.conn.name {
+		err = NewTApplicationException(WRONG_METHOD_NAME, p.conn.name+": wrong method name")
+	} else if err == nil && seqid != p.conn.seqid {
+		err = NewTApplicationException(BAD_SEQUENCE_ID, p.conn.name+": out of sequence response")
+	}
+	return name, typeId, seqid, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadMessageEnd() error {
+	if err := p.proto.ReadMessageEnd(); err != nil {
+		return p.conn.fail(err)
+	}
+	p.conn.release()
+	return nil
+}
+
+func (p *tSharedConnectionProtocol) WriteMessageEnd() error {
+	return p.conn.fail(p.proto.WriteMessageEnd())
+}
+
+func (p *tSharedConnectionProtocol) WriteStructBegin(name string) error {
+	return p.conn.fail(p.proto.WriteStructBegin(name))
+}
+
+func (p *tSharedConnectionProtocol) WriteStructEnd() error {
+	return p.conn.fail(p.proto.WriteStructEnd())
+}
+
+func (p *tSharedConnectionProtocol) WriteFieldBegin(name string, typeId TType, id int16) error {
+	return p.conn.fail(p.proto.WriteFieldBegin(name, typeId, id))
+}
+
+func (p *tSharedConnectionProtocol) WriteFieldEnd() error {
+	return p.conn.fail(p.proto.WriteFieldEnd())
+}
+
+func (p *tSharedConnectionProtocol) WriteFieldStop() error {
+	return p.conn.fail(p.proto.WriteFieldStop())
+}
+
+func (p *tSharedConnectionProtocol) WriteMapBegin(keyType TType, valueType TType, size int) error {
+	return p.conn.fail(p.proto.WriteMapBegin(keyType, valueType, size))
+}
+
+func (p *tSharedConnectionProtocol) WriteMapEnd() error {
+	return p.conn.fail(p.proto.WriteMapEnd())
+}
+
+func (p *tSharedConnectionProtocol) WriteListBegin(elemType TType, size int) error {
+	return p.conn.fail(p.proto.WriteListBegin(elemType, size))
+}
+
+func (p *tSharedConnectionProtocol) WriteListEnd() error {
+	return p.conn.fail(p.proto.WriteListEnd())
+}
+
+func (p *tSharedConnectionProtocol) WriteSetBegin(elemType TType, size int) error {
+	return p.conn.fail(p.proto.WriteSetBegin(elemType, size))
+}
+
+func (p *tSharedConnectionProtocol) WriteSetEnd() error {
+	return p.conn.fail(p.proto.WriteSetEnd())
+}
+
+func (p *tSharedConnectionProtocol) WriteBool(value bool) error {
+	return p.conn.fail(p.proto.WriteBool(value))
+}
+
+func (p *tSharedConnectionProtocol) WriteByte(value byte) error {
+	return p.conn.fail(p.proto.WriteByte(value))
+}
+
+func (p *tSharedConnectionProtocol) WriteI16(value int16) error {
+	return p.conn.fail(p.proto.WriteI16(value))
+}
+
+func (p *tSharedConnectionProtocol) WriteI32(value int32) error {
+	return p.conn.fail(p.proto.WriteI32(value))
+}
+
+func (p *tSharedConnectionProtocol) WriteI64(value int64) error {
+	return p.conn.fail(p.proto.WriteI64(value))
+}
+
+func (p *tSharedConnectionProtocol) WriteDouble(value float64) error {
+	return p.conn.fail(p.proto.WriteDouble(value))
+}
+
+func (p *tSharedConnectionProtocol) WriteString(value string) error {
+	return p.conn.fail(p.proto.WriteString(value))
+}
+
+func (p *tSharedConnectionProtocol) WriteBinary(value []byte) error {
+	return p.conn.fail(p.proto.WriteBinary(value))
+}
+
+func (p *tSharedConnectionProtocol) ReadStructBegin() (name string, err error) {
+	name, err = p.proto.ReadStructBegin()
+	return name, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadStructEnd() error {
+	return p.conn.fail(p.proto.ReadStructEnd())
+}
+
+func (p *tSharedConnectionProtocol) ReadFieldBegin() (name string, typeId TType, id int16, err error) {
+	name, typeId, id, err = p.proto.ReadFieldBegin()
+	return name, typeId, id, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadFieldEnd() error {
+	return p.conn.fail(p.proto.ReadFieldEnd())
+}
+
+func (p *tSharedConnectionProtocol) ReadMapBegin() (keyType TType, valueType TType, size int, err error) {
+	keyType, valueType, size, err = p.proto.ReadMapBegin()
+	return keyType, valueType, size, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadMapEnd() error {
+	return p.conn.fail(p.proto.ReadMapEnd())
+}
+
+func (p *tSharedConnectionProtocol) ReadListBegin() (elemType TType, size int, err error) {
+	elemType, size, err = p.proto.ReadListBegin()
+	return elemType, size, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadListEnd() error {
+	return p.conn.fail(p.proto.ReadListEnd())
+}
+
+func (p *tSharedConnectionProtocol) ReadSetBegin() (elemType TType, size int, err error) {
+	elemType, size, err = p.proto.ReadSetBegin()
+	return elemType, size, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadSetEnd() error {
+	return p.conn.fail(p.proto.ReadSetEnd())
+}
+
+func (p *tSharedConnectionProtocol) ReadBool() (value bool, err error) {
+	value, err = p.proto.ReadBool()
+	return value, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadByte() (value byte, err error) {
+	value, err = p.proto.ReadByte()
+	return value, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadI16() (value int16, err error) {
+	value, err = p.proto.ReadI16()
+	return value, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadI32() (value int32, err error) {
+	value, err = p.proto.ReadI32()
+	return value, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadI64() (value int64, err error) {
+	value, err = p.proto.ReadI64()
+	return value, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadDouble() (value float64, err error) {
+	value, err = p.proto.ReadDouble()
+	return value, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadString() (value string, err error) {
+	value, err = p.proto.ReadString()
+	return value, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) ReadBinary() (value []byte, err error) {
+	value, err = p.proto.ReadBinary()
+	return value, p.conn.fail(err)
+}
+
+func (p *tSharedConnectionProtocol) Skip(fieldType TType) error {
+	return p.conn.fail(p.proto.Skip(fieldType))
+}
+
+func (p *tSharedConnectionProtocol) Transport() TTransport {
+	return p.proto.Transport()
+}
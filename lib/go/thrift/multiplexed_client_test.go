@@ -0,0 +1,140 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"sync"
+	"testing"
+)
+
+// Serves testEchoProcessor as services A and B over a loopback transport
+// and returns an opened client transport.
+func newTestMultiplexedServer(t *testing.T) TTransport {
+	processor := NewTMultiplexedProcessor()
+	processor.RegisterProcessor("A", &testEchoProcessor{})
+	processor.RegisterProcessor("B", &testEchoProcessor{})
+	trans := NewTLoopbackServerTransport()
+	server := NewTSimpleServer4(processor, trans, NewTTransportFactory(), NewTBinaryProtocolFactoryDefault())
+	server.SetLogger(NopLogger)
+	trans.Listen()
+	go server.Serve()
+	t.Cleanup(func() { server.Stop() })
+	client := trans.Client(0)
+	if err := client.Open(); err != nil {
+		t.Fatalf("Unable to open client: %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestMultiplexedProtocolFactory(t *testing.T) {
+	trans := newTestMultiplexedServer(t)
+	p := NewTMultiplexedProtocolFactory(NewTBinaryProtocolFactoryDefault(), "A").GetProtocol(trans)
+	result := &testCallStruct{}
+	if err := NewTStandardClient(p, p).Call("echo", &testCallStruct{3}, result); err != nil || result.Value != 3 {
+		t.Fatalf("Unexpected reply %v %d", err, result.Value)
+	}
+}
+
+func TestMultiplexedConnection(t *testing.T) {
+	conn := NewTMultiplexedConnection(newTestMultiplexedServer(t), NewTBinaryProtocolFactoryDefault())
+	clients := []TClient{conn.Client("A"), conn.Client("B")}
+	var wg sync.WaitGroup
+	errors := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result := &testCallStruct{}
+			if err := clients[i%2].Call("echo", &testCallStruct{int32(i)}, result); err != nil {
+				errors <- err
+			} else if result.Value != int32(i) {
+				t.Errorf("Expected %d, got %d", i, result.Value)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errors)
+	for err := range errors {
+		t.Fatalf("Call failed: %s", err)
+	}
+
+	err := conn.Client("C").Call("echo", &testCallStruct{1}, &testCallStruct{})
+	if x, ok := err.(TApplicationException); !ok || x.TypeId() != UNKNOWN_METHOD {
+		t.Fatalf("Expected UNKNOWN_METHOD, got %v", err)
+	}
+}
+
+// Generated clients take a transport and a protocol factory, and write and
+// read each call through two protocols of that factory.
+func TestMultiplexedConnectionProtocolFactory(t *testing.T) {
+	trans := &testBreakableTransport{TTransport: newTestMultiplexedServer(t)}
+	conn := NewTMultiplexedConnection(trans, NewTBinaryProtocolFactoryDefault())
+	var clients []*TStandardClient
+	for _, service := range []string{"A", "B"} {
+		f := conn.ProtocolFactory(service)
+		clients = append(clients, NewTStandardClient(f.GetProtocol(conn.Transport()), f.GetProtocol(conn.Transport())))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(client *TStandardClient) {
+			defer wg.Done()
+			for j := int32(0); j < 10; j++ {
+				result := &testCallStruct{}
+				if err := client.Call("echo", &testCallStruct{j}, result); err != nil {
+					t.Errorf("Call failed: %s", err)
+					return
+				} else if result.Value != j {
+					t.Errorf("Expected %d, got %d", j, result.Value)
+				}
+			}
+		}(clients[i])
+	}
+	wg.Wait()
+
+	// A call failing in the middle of its request releases the connection
+	// and closes the transport.
+	trans.broken = true
+	if err := clients[0].Call("echo", &testCallStruct{1}, &testCallStruct{}); err == nil {
+		t.Fatal("Expected the call to fail")
+	}
+	trans.broken = false
+	if conn.Transport().IsOpen() {
+		t.Fatal("Expected the transport to be closed after a failed call")
+	}
+	err := clients[1].Call("echo", &testCallStruct{1}, &testCallStruct{})
+	if e, ok := err.(TTransportException); !ok || e.TypeId() != NOT_OPEN {
+		t.Fatalf("Expected NOT_OPEN, got %v", err)
+	}
+}
+
+// Transport whose writes fail once broken is set.
+type testBreakableTransport struct {
+	TTransport
+	broken bool
+}
+
+func (p *testBreakableTransport) Write(buf []byte) (int, error) {
+	if p.broken {
+		return 0, NewTTransportException(UNKNOWN_TRANSPORT_EXCEPTION, "write failed")
+	}
+	return p.TTransport.Write(buf)
+}
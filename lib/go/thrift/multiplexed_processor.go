@@ -6,7 +6,9 @@ package thrift
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 )
 
 /**
@@ -51,7 +53,13 @@ func (p *StoredMessageProtocol) ReadMessageBegin() (name string, typeId TMessage
  * </code></blockquote>
  */
 type TMultiplexedProcessor struct {
-	processors map[string]TProcessor
+	mu               sync.RWMutex
+	processors       map[string]TProcessor
+	defaultProcessor TProcessor
+}
+
+func NewTMultiplexedProcessor() *TMultiplexedProcessor {
+	return &TMultiplexedProcessor{processors: make(map[string]TProcessor)}
 }
 
 /**
@@ -65,27 +73,73 @@ type TMultiplexedProcessor struct {
  * as "handlers", e.g. WeatherReportHandler implementing WeatherReport.Iface.
  */
 func (p *TMultiplexedProcessor) RegisterProcessor(serviceName string, processor TProcessor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if p.processors == nil {
 		p.processors = make(map[string]TProcessor)
 	}
 	p.processors[serviceName] = processor
 }
 
+/**
+ * Removes a service registered with RegisterProcessor. Calls to it fail with
+ * an UNKNOWN_METHOD application exception from then on.
+ */
+func (p *TMultiplexedProcessor) UnregisterProcessor(serviceName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.processors, serviceName)
+}
+
+/**
+ * Registers the processor for calls without a service name, as sent by
+ * clients that do not use a TMultiplexedProtocol. Passing nil removes it.
+ */
+func (p *TMultiplexedProcessor) RegisterDefault(processor TProcessor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.defaultProcessor = processor
+}
+
+/**
+ * Returns the sorted names of the registered services.
+ */
+func (p *TMultiplexedProcessor) Services() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	services := make([]string, 0, len(p.processors))
+	for name := range p.processors {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+	return services
+}
+
+func (p *TMultiplexedProcessor) lookup(serviceName string) (TProcessor, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if serviceName == "" {
+		return p.defaultProcessor, p.defaultProcessor != nil
+	}
+	processor, ok := p.processors[serviceName]
+	return processor, ok
+}
+
 /**
  * This implementation of <code>process</code> performs the following steps:
  *
  * <ol>
  *     <li>Read the beginning of the message.</li>
  *     <li>Extract the service name from the message.</li>
- *     <li>Using the service name to locate the appropriate processor.</li>
+ *     <li>Using the service name to locate the appropriate processor, or the
+ *         default processor for names without a service name.</li>
  *     <li>Dispatch to the processor, with a decorated instance of TProtocol
  *         that allows ReadMessageBegin() to return the original TMessage.</li>
  * </ol>
  *
- * @throws TException If the message type is not CALL or ONEWAY, if
- * the service name was not found in the message, or if the service
- * name was not found in the service map.  You called {@link #registerProcessor(String, TProcessor) registerProcessor}
- * during initialization, right? :)
+ * Messages that are not calls, and calls of unknown services, are skipped
+ * and answered with a TApplicationException, which is also returned. As for
+ * any other reply, the service name is not part of the reply's name.
  */
 func (p *TMultiplexedProcessor) Process(in, out TProtocol) (bool, TException) {
 	/*
@@ -99,31 +153,27 @@ func (p *TMultiplexedProcessor) Process(in, out TProtocol) (bool, TException) {
 	}
 
 	if typeId != CALL && typeId != ONEWAY {
-		// TODO Apache Guys - Can the server ever get an EXCEPTION or REPLY?
-		// TODO Should we check for this here?
-		return false, TException(fmt.Errorf("This should not have happened!?"))
+		return false, p.reject(in, out, name, typeId, seqid, NewTApplicationException(INVALID_MESSAGE_TYPE_EXCEPTION,
+			fmt.Sprintf("Unexpected message type %d for %s", typeId, name)))
 	}
 
-	// Extract the service name
-	index := strings.Index(name, SEPARATOR)
-	if index < 0 || index >= len(name)-1 {
-		return false, TException(fmt.Errorf(
-			"Service name not found in message name: " + name + ".  Did you " +
-				"forget to use a TMultiplexProtocol in your client?"))
+	// Extract the service name, if any
+	serviceName, standardName := "", name
+	if index := strings.Index(name, SEPARATOR); index >= 0 {
+		serviceName, standardName = name[:index], name[index+1:]
 	}
-
-	// Create a new TMessage, something that can be consumed by any TProtocol
-	serviceName := name[:index]
-	actualProcessor, ok := p.processors[serviceName]
+	actualProcessor, ok := p.lookup(serviceName)
 	if !ok {
-		return false, TException(fmt.Errorf(
-			"Service name not found: " + serviceName + ".  Did you forget " +
+		if serviceName == "" {
+			return false, p.reject(in, out, name, typeId, seqid, NewTApplicationException(UNKNOWN_METHOD,
+				"Service name not found in message name: "+name+".  Did you "+
+					"forget to use a TMultiplexProtocol in your client?"))
+		}
+		return false, p.reject(in, out, standardName, typeId, seqid, NewTApplicationException(UNKNOWN_METHOD,
+			"Service name not found: "+serviceName+".  Did you forget "+
 				"to call registerProcessor()?"))
 	}
 
-	// Remove the service name from the message name
-	standardName := name[index+1:]
-
 	// Dispatch processing to the stored processor
 	return actualProcessor.Process(
 		&StoredMessageProtocol{
@@ -134,3 +184,20 @@ func (p *TMultiplexedProcessor) Process(in, out TProtocol) (bool, TException) {
 			err,
 		}, out)
 }
+
+/**
+ * Skips the rest of a message that cannot be processed and, unless the
+ * caller expects no reply, writes the exception back.
+ */
+func (p *TMultiplexedProcessor) reject(in, out TProtocol, name string, typeId TMessageType, seqid int32, x TApplicationException) TException {
+	in.Skip(STRUCT)
+	in.ReadMessageEnd()
+	if typeId == ONEWAY {
+		return x
+	}
+	out.WriteMessageBegin(name, EXCEPTION, seqid)
+	x.Write(out)
+	out.WriteMessageEnd()
+	out.Flush()
+	return x
+}
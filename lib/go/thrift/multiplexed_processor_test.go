@@ -2,6 +2,7 @@ package thrift
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 )
 
@@ -12,10 +13,6 @@ const TestMultiplexedProcessor_SEQ = 1
 const TestMultiplexedProcessor_IN_VALUE = int32(27)
 const TestMultiplexedProcessor_OUT_VALUE = int32(32)
 
-func NewTMultiplexedProcessor() *TMultiplexedProcessor {
-	return &TMultiplexedProcessor{}
-}
-
 type DummyProcessor struct {
 	t *testing.T
 }
@@ -26,9 +23,9 @@ func (p *DummyProcessor) Process(in, out TProtocol) (bool, TException) {
 	} else if name != TestMultiplexedProcessor_FN {
 		p.t.Fatalf("DummyProcessor.Process() expected message %q but got %q", TestMultiplexedProcessor_FN, name)
 	} else if typeId != TestMultiplexedProcessor_IN_TYPE {
-		p.t.Fatalf("DummyProcessor.Process() expected message %q but got %q", TestMultiplexedProcessor_IN_TYPE, typeId)
+		p.t.Fatalf("DummyProcessor.Process() expected message type %v but got %v", TestMultiplexedProcessor_IN_TYPE, typeId)
 	} else if seqid != TestMultiplexedProcessor_SEQ {
-		p.t.Fatalf("DummyProcessor.Process() expected message %q but got %q", TestMultiplexedProcessor_SEQ, seqid)
+		p.t.Fatalf("DummyProcessor.Process() expected seqid %v but got %v", TestMultiplexedProcessor_SEQ, seqid)
 	}
 
 	if v, e := in.ReadI32(); e != nil {
@@ -88,3 +85,92 @@ func TestMultiplexedProcessorProcess(t *testing.T) {
 		t.Fatalf("Expected response %q but got %q", response, s)
 	}
 }
+
+// Processes a binary message and returns the reply.
+func processMultiplexedCall(t *testing.T, p TProcessor, name string, typeId TMessageType) (*TMemoryBuffer, TException) {
+	in := NewTMemoryBuffer()
+	writeTestReply(t, NewTBinaryProtocolTransport(in), name, typeId, 7, &testCallStruct{5})
+	out := NewTMemoryBuffer()
+	_, err := p.Process(NewTBinaryProtocolTransport(in), NewTBinaryProtocolTransport(out))
+	if in.Len() != 0 {
+		t.Fatalf("%s: %d bytes of the message left unread", name, in.Len())
+	}
+	return out, err
+}
+
+func expectMultiplexedException(t *testing.T, out *TMemoryBuffer, name string, typeId int32) {
+	p := NewTBinaryProtocolTransport(out)
+	replyName, replyType, seqId, err := p.ReadMessageBegin()
+	if err != nil || replyName != name || replyType != EXCEPTION || seqId != 7 {
+		t.Fatalf("Expected an exception reply to %s, got %q %d %d %v", name, replyName, replyType, seqId, err)
+	}
+	x, err := NewTApplicationException(UNKNOWN_APPLICATION_EXCEPTION, "").Read(p)
+	if err != nil || x.TypeId() != typeId {
+		t.Fatalf("Expected exception type %d, got %v %v", typeId, x, err)
+	}
+}
+
+func TestMultiplexedProcessorUnknownService(t *testing.T) {
+	p := NewTMultiplexedProcessor()
+	p.RegisterProcessor("Echo", &testEchoProcessor{})
+
+	for _, name := range []string{"Other:echo", "echo"} {
+		out, err := processMultiplexedCall(t, p, name, CALL)
+		if x, ok := err.(TApplicationException); !ok || x.TypeId() != UNKNOWN_METHOD {
+			t.Fatalf("%s: expected an UNKNOWN_METHOD exception, got %v", name, err)
+		}
+		expectMultiplexedException(t, out, "echo", UNKNOWN_METHOD)
+	}
+
+	out, err := processMultiplexedCall(t, p, "Other:echo", ONEWAY)
+	if err == nil || out.Len() != 0 {
+		t.Fatalf("Expected an error and no reply for a oneway call, got %v and %d bytes", err, out.Len())
+	}
+
+	out, _ = processMultiplexedCall(t, p, "Echo:echo", REPLY)
+	expectMultiplexedException(t, out, "Echo:echo", INVALID_MESSAGE_TYPE_EXCEPTION)
+}
+
+func TestMultiplexedProcessorDefault(t *testing.T) {
+	p := NewTMultiplexedProcessor()
+	p.RegisterProcessor("Echo", &testEchoProcessor{})
+	p.RegisterDefault(&testEchoProcessor{})
+	for _, name := range []string{"echo", "Echo:echo"} {
+		out, err := processMultiplexedCall(t, p, name, CALL)
+		if err != nil {
+			t.Fatalf("%s: process failed: %s", name, err)
+		}
+		result := &testCallStruct{}
+		if err := NewTStandardClient(nil, nil).Recv(NewTBinaryProtocolTransport(out), 7, "echo", result); err != nil || result.Value != 5 {
+			t.Fatalf("%s: unexpected reply %v %d", name, err, result.Value)
+		}
+	}
+}
+
+func TestMultiplexedProcessorRegistration(t *testing.T) {
+	p := NewTMultiplexedProcessor()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		name := fmt.Sprint("Service", i)
+		go func() {
+			defer wg.Done()
+			p.RegisterProcessor(name, &testEchoProcessor{})
+		}()
+		go func() {
+			defer wg.Done()
+			processMultiplexedCall(t, p, name+":echo", CALL)
+		}()
+	}
+	wg.Wait()
+	if services := p.Services(); len(services) != 10 || services[0] != "Service0" {
+		t.Fatalf("Unexpected services %v", services)
+	}
+	p.UnregisterProcessor("Service0")
+	if _, err := processMultiplexedCall(t, p, "Service0:echo", CALL); err == nil {
+		t.Fatal("Expected an error calling an unregistered service")
+	}
+	if services := p.Services(); len(services) != 9 || services[0] != "Service1" {
+		t.Fatalf("Unexpected services %v", services)
+	}
+}
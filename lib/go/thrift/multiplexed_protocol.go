@@ -37,6 +37,18 @@ type TMultiplexedProtocol struct {
 	serviceName string
 }
 
+/**
+ * Wraps protocol so that calls are addressed to the service serviceName of a
+ * TMultiplexedProcessor.
+ */
+func NewTMultiplexedProtocolFromProtocol(protocol TProtocol, serviceName string) *TMultiplexedProtocol {
+	return &TMultiplexedProtocol{NewTProtocolDecorator(protocol), serviceName}
+}
+
+/**
+ * Deprecated: the returned value does not implement TProtocol, only a pointer
+ * to it does. Use NewTMultiplexedProtocolFromProtocol.
+ */
 func NewMultiplexedProtocol(p TProtocolDecorator, serviceName string) TMultiplexedProtocol {
 	return TMultiplexedProtocol{p, serviceName}
 }
@@ -1,18 +1,29 @@
 package thrift
 
+/**
+ * <code>TMultiplexedProtocolFactory</code> wraps the protocols of any
+ * <code>TProtocolFactory</code> in a <code>TMultiplexedProtocol</code> for
+ * one service, so that generated clients built from a protocol factory can
+ * call a multiplexing server:
+ *
+ * <blockquote><code>
+ *     pf := thrift.NewTMultiplexedProtocolFactory(thrift.NewTBinaryProtocolFactoryDefault(), "Calculator")
+ *     client := tutorial.NewCalculatorClientFactory(transport, pf)
+ * </code></blockquote>
+ */
 type TMultiplexedProtocolFactory struct {
 	pf          TProtocolFactory
 	serviceName string
 }
 
+func NewTMultiplexedProtocolFactory(protocolFactory TProtocolFactory, serviceName string) *TMultiplexedProtocolFactory {
+	return &TMultiplexedProtocolFactory{protocolFactory, serviceName}
+}
+
 func NewMultiplexedProtocolFactory(p TProtocolFactory, serviceName string) TMultiplexedProtocolFactory {
 	return TMultiplexedProtocolFactory{p, serviceName}
 }
 
 func (f TMultiplexedProtocolFactory) GetProtocol(trans TTransport) TProtocol {
-	p := NewMultiplexedProtocol(
-		NewTProtocolDecorator(f.pf.GetProtocol(trans)),
-		f.serviceName,
-	)
-	return &p
+	return NewTMultiplexedProtocolFromProtocol(f.pf.GetProtocol(trans), f.serviceName)
 }
@@ -38,6 +38,7 @@ package thrift
 // exported thrift structs, we factor such helpers here.
 ///////////////////////////////////////////////////////////////////////////////
 
+func BoolPtr(v bool) *bool          { return &v }
 func Float32Ptr(v float32) *float32 { return &v }
 func Float64Ptr(v float64) *float64 { return &v }
 func IntPtr(v int) *int             { return &v }
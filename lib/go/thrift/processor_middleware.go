@@ -0,0 +1,103 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TCallInfo describes an incoming message. It is filled in from the message
+// header, which is read only once for the whole middleware chain.
+type TCallInfo struct {
+	// Service name for calls sent through a TMultiplexedProtocol, empty
+	// otherwise.
+	Service string
+	// Method name without the service prefix.
+	Method string
+	SeqId  int32
+	TypeId TMessageType
+	// Time at which the message header was read.
+	Start time.Time
+}
+
+// Name returns the message name as it was sent on the wire.
+func (c *TCallInfo) Name() string {
+	if c.Service == "" {
+		return c.Method
+	}
+	return c.Service + SEPARATOR + c.Method
+}
+
+// ProcessorHandler processes a message whose header has already been read
+// into call. in will replay that header on ReadMessageBegin.
+type ProcessorHandler func(call *TCallInfo, in, out TProtocol) (bool, TException)
+
+// ProcessorMiddleware wraps a ProcessorHandler with additional behaviour.
+type ProcessorMiddleware func(next ProcessorHandler) ProcessorHandler
+
+type tWrappedProcessor struct {
+	processor TProcessor
+	handler   ProcessorHandler
+}
+
+// WrapProcessor returns a TProcessor that runs every message through the
+// middlewares before handing it to processor. The first middleware is the
+// outermost one. Any TProcessor may be wrapped, including a
+// TMultiplexedProcessor.
+func WrapProcessor(processor TProcessor, middlewares ...ProcessorMiddleware) TProcessor {
+	handler := func(call *TCallInfo, in, out TProtocol) (bool, TException) {
+		return processor.Process(in, out)
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return &tWrappedProcessor{processor: processor, handler: handler}
+}
+
+func (p *tWrappedProcessor) Process(in, out TProtocol) (bool, TException) {
+	name, typeId, seqId, err := in.ReadMessageBegin()
+	if err != nil {
+		return false, err
+	}
+	call := &TCallInfo{Method: name, SeqId: seqId, TypeId: typeId, Start: time.Now()}
+	if index := strings.Index(name, SEPARATOR); index >= 0 {
+		call.Service = name[:index]
+		call.Method = name[index+1:]
+	}
+	return p.handler(call, &StoredMessageProtocol{NewTProtocolDecorator(in), name, typeId, seqId, nil}, out)
+}
+
+// NewLoggingProcessorMiddleware logs one line per message with the call
+// details, duration and resulting error.
+func NewLoggingProcessorMiddleware(logger Logger) ProcessorMiddleware {
+	if logger == nil {
+		logger = StdLogger(nil)
+	}
+	return func(next ProcessorHandler) ProcessorHandler {
+		return func(call *TCallInfo, in, out TProtocol) (bool, TException) {
+			ok, err := next(call, in, out)
+			logger(fmt.Sprintf("thrift server call: service=%q method=%q seqid=%d type=%d duration=%s error=%v",
+				call.Service, call.Method, call.SeqId, call.TypeId, time.Since(call.Start), err))
+			return ok, err
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"strings"
+	"testing"
+)
+
+// Processor answering "echo" with its argument, shaped like a generated
+// processor.
+type testEchoProcessor struct{}
+
+func (p *testEchoProcessor) Process(in, out TProtocol) (bool, TException) {
+	name, _, seqId, err := in.ReadMessageBegin()
+	if err != nil {
+		return false, err
+	}
+	if name != "echo" {
+		in.Skip(STRUCT)
+		in.ReadMessageEnd()
+		x := NewTApplicationException(UNKNOWN_METHOD, "Unknown function "+name)
+		out.WriteMessageBegin(name, EXCEPTION, seqId)
+		x.Write(out)
+		out.WriteMessageEnd()
+		out.Flush()
+		return false, x
+	}
+	args := &testCallStruct{}
+	if err := args.Read(in); err != nil {
+		return false, err
+	}
+	in.ReadMessageEnd()
+	out.WriteMessageBegin(name, REPLY, seqId)
+	args.Write(out)
+	out.WriteMessageEnd()
+	return true, out.Flush()
+}
+
+func writeTestCall(t *testing.T, trans TTransport, method string, seqId int32, value int32) {
+	writeTestReply(t, NewTBinaryProtocolTransport(trans), method, CALL, seqId, &testCallStruct{value})
+}
+
+func TestWrapProcessor(t *testing.T) {
+	var calls []TCallInfo
+	var order []string
+	record := func(name string) ProcessorMiddleware {
+		return func(next ProcessorHandler) ProcessorHandler {
+			return func(call *TCallInfo, in, out TProtocol) (bool, TException) {
+				order = append(order, name)
+				ok, err := next(call, in, out)
+				calls = append(calls, *call)
+				return ok, err
+			}
+		}
+	}
+	in := NewTMemoryBuffer()
+	out := NewTMemoryBuffer()
+	writeTestCall(t, in, "echo", 3, 7)
+	processor := WrapProcessor(&testEchoProcessor{}, record("first"), record("second"))
+	if ok, err := processor.Process(NewTBinaryProtocolTransport(in), NewTBinaryProtocolTransport(out)); !ok || err != nil {
+		t.Fatalf("Process() failed: %v", err)
+	}
+	if strings.Join(order, ",") != "first,second" {
+		t.Fatalf("Unexpected middleware order %v", order)
+	}
+	if calls[0].Method != "echo" || calls[0].SeqId != 3 || calls[0].TypeId != CALL || calls[0].Service != "" {
+		t.Fatalf("Unexpected call info %+v", calls[0])
+	}
+	result := &testCallStruct{}
+	if err := new(TStandardClient).Recv(NewTBinaryProtocolTransport(out), 3, "echo", result); err != nil {
+		t.Fatalf("Recv() failed: %s", err)
+	}
+	if result.Value != 7 {
+		t.Fatalf("Expected 7 but got %d", result.Value)
+	}
+}
+
+func TestWrapMultiplexedProcessor(t *testing.T) {
+	var info *TCallInfo
+	var result TException
+	mp := NewTMultiplexedProcessor()
+	mp.RegisterProcessor("Echo", &testEchoProcessor{})
+	processor := WrapProcessor(mp, func(next ProcessorHandler) ProcessorHandler {
+		return func(call *TCallInfo, in, out TProtocol) (bool, TException) {
+			ok, err := next(call, in, out)
+			info, result = call, err
+			return ok, err
+		}
+	})
+
+	in := NewTMemoryBuffer()
+	out := NewTMemoryBuffer()
+	writeTestCall(t, in, "Echo:missing", 1, 0)
+	processor.Process(NewTBinaryProtocolTransport(in), NewTBinaryProtocolTransport(out))
+	if info.Service != "Echo" || info.Method != "missing" {
+		t.Fatalf("Unexpected call info %+v", info)
+	}
+	if e, ok := result.(TApplicationException); !ok || e.TypeId() != UNKNOWN_METHOD {
+		t.Fatalf("Expected UNKNOWN_METHOD exception but got %v", result)
+	}
+}
+
+func TestLoggingProcessorMiddleware(t *testing.T) {
+	var lines []string
+	in := NewTMemoryBuffer()
+	writeTestCall(t, in, "echo", 1, 1)
+	processor := WrapProcessor(&testEchoProcessor{}, NewLoggingProcessorMiddleware(func(msg string) { lines = append(lines, msg) }))
+	processor.Process(NewTBinaryProtocolTransport(in), NewTBinaryProtocolTransport(NewTMemoryBuffer()))
+	if len(lines) != 1 || !strings.Contains(lines[0], `method="echo"`) {
+		t.Fatalf("Unexpected log output %v", lines)
+	}
+}
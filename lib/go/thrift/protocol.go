@@ -19,6 +19,14 @@
 
 package thrift
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
 const (
 	VERSION_MASK = 0xffff0000
 	VERSION_1    = 0x80010000
@@ -77,6 +85,16 @@ type TProtocol interface {
 // The maximum recursive depth the skip() function will traverse
 var MaxSkipDepth = 1<<31 - 1
 
+// The maximum number of elements of a list, set or map accepted when
+// reading. Generated code allocates containers up front, so larger sizes are
+// rejected with a SIZE_LIMIT TProtocolException before they are used.
+var MaxContainerSize = 16 * 1024 * 1024
+
+// The maximum length of a string or binary value accepted when reading.
+// Values are read incrementally, so a corrupt size only costs memory once
+// the data actually arrives.
+var MaxStringSize = math.MaxInt32
+
 // Skips over the next data element from the provided input TProtocol object.
 func SkipDefaultDepth(prot TProtocol, typeId TType) (err error) {
 	return Skip(prot, typeId, MaxSkipDepth)
@@ -84,6 +102,9 @@ func SkipDefaultDepth(prot TProtocol, typeId TType) (err error) {
 
 // Skips over the next data element from the provided input TProtocol object.
 func Skip(self TProtocol, fieldType TType, maxDepth int) (err error) {
+	if maxDepth <= 0 {
+		return NewTProtocolExceptionWithType(DEPTH_LIMIT, errors.New("Depth limit exceeded"))
+	}
 	switch fieldType {
 	case STOP:
 		return
@@ -113,12 +134,19 @@ func Skip(self TProtocol, fieldType TType, maxDepth int) (err error) {
 			return err
 		}
 		for {
-			_, typeId, _, _ := self.ReadFieldBegin()
+			_, typeId, _, err := self.ReadFieldBegin()
+			if err != nil {
+				return err
+			}
 			if typeId == STOP {
 				break
 			}
-			Skip(self, typeId, maxDepth-1)
-			self.ReadFieldEnd()
+			if err := Skip(self, typeId, maxDepth-1); err != nil {
+				return err
+			}
+			if err := self.ReadFieldEnd(); err != nil {
+				return err
+			}
 		}
 		return self.ReadStructEnd()
 	case MAP:
@@ -127,8 +155,12 @@ func Skip(self TProtocol, fieldType TType, maxDepth int) (err error) {
 			return err
 		}
 		for i := 0; i < size; i++ {
-			Skip(self, keyType, maxDepth-1)
-			self.Skip(valueType)
+			if err := Skip(self, keyType, maxDepth-1); err != nil {
+				return err
+			}
+			if err := Skip(self, valueType, maxDepth-1); err != nil {
+				return err
+			}
 		}
 		return self.ReadMapEnd()
 	case SET:
@@ -137,7 +169,9 @@ func Skip(self TProtocol, fieldType TType, maxDepth int) (err error) {
 			return err
 		}
 		for i := 0; i < size; i++ {
-			Skip(self, elemType, maxDepth-1)
+			if err := Skip(self, elemType, maxDepth-1); err != nil {
+				return err
+			}
 		}
 		return self.ReadSetEnd()
 	case LIST:
@@ -146,9 +180,59 @@ func Skip(self TProtocol, fieldType TType, maxDepth int) (err error) {
 			return err
 		}
 		for i := 0; i < size; i++ {
-			Skip(self, elemType, maxDepth-1)
+			if err := Skip(self, elemType, maxDepth-1); err != nil {
+				return err
+			}
 		}
 		return self.ReadListEnd()
+	default:
+		return NewTProtocolExceptionWithType(INVALID_DATA, fmt.Errorf("Unknown data type %d", fieldType))
+	}
+}
+
+// Implemented by transports that know how many bytes are left to read, so
+// that sizes which cannot possibly be satisfied are rejected early.
+type tRemainingBytes interface {
+	remainingBytes() int
+}
+
+// Returns the number of bytes left to read from trans, or -1 if unknown.
+func remainingBytes(trans TTransport) int {
+	if r, ok := trans.(tRemainingBytes); ok {
+		return r.remainingBytes()
+	}
+	return -1
+}
+
+// Checks a string or container size read from the wire against limit and,
+// if known, against the remaining input, as every element takes at least a
+// byte.
+func checkReadSize(size, limit, remaining int) error {
+	if size < 0 {
+		return NewTProtocolExceptionWithType(NEGATIVE_SIZE, fmt.Errorf("Negative size %d", size))
+	}
+	if size > limit {
+		return NewTProtocolExceptionWithType(SIZE_LIMIT, fmt.Errorf("Size %d exceeds the limit of %d", size, limit))
+	}
+	if remaining >= 0 && size > remaining {
+		return NewTProtocolExceptionWithType(INVALID_DATA, fmt.Errorf("Size %d exceeds the %d remaining bytes", size, remaining))
 	}
 	return nil
 }
+
+// Reads exactly size bytes. Large values are read in chunks so that the
+// allocation grows with the data received rather than with the size claimed.
+func readSizedBytes(r io.Reader, size int) ([]byte, error) {
+	const chunkSize = 64 * 1024
+	if size <= chunkSize {
+		buf := make([]byte, size)
+		_, err := io.ReadFull(r, buf)
+		return buf, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, chunkSize))
+	n, err := io.CopyN(buf, r, int64(size))
+	if err == io.EOF && n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), err
+}
@@ -0,0 +1,243 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"time"
+)
+
+const (
+	DEFAULT_RECONNECT_MIN_BACKOFF = 100 * time.Millisecond
+	DEFAULT_RECONNECT_MAX_BACKOFF = 30 * time.Second
+)
+
+type TReconnectEventType int
+
+const (
+	// The connection broke; Err is the error that revealed it.
+	DISCONNECTED TReconnectEventType = iota
+	// The connection was reopened.
+	RECONNECTED
+	// Reopening failed; Err is the error of Open.
+	RECONNECT_FAILED
+)
+
+func (p TReconnectEventType) String() string {
+	switch p {
+	case DISCONNECTED:
+		return "DISCONNECTED"
+	case RECONNECTED:
+		return "RECONNECTED"
+	case RECONNECT_FAILED:
+		return "RECONNECT_FAILED"
+	}
+	return "<UNSET>"
+}
+
+// A change of the connection of a TReconnectingTransport. Attempt counts the
+// attempts to reopen it since it broke, starting at 1.
+type TReconnectEvent struct {
+	Type    TReconnectEventType
+	Attempt int
+	Err     error
+}
+
+type TReconnectOptions struct {
+	// The time to wait after a failed attempt before the next one, doubled
+	// after every further failure up to MaxBackoff. Default to
+	// DEFAULT_RECONNECT_MIN_BACKOFF and DEFAULT_RECONNECT_MAX_BACKOFF.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Called for every event, on the goroutine using the transport.
+	OnEvent func(event TReconnectEvent)
+}
+
+// TReconnectingTransport reopens its underlying transport, typically a
+// TSocket, when the connection breaks, so that long-lived clients recover
+// from server restarts and network failures.
+//
+// A connection is considered broken when a read, write or flush fails for
+// any reason, or when the underlying transport has been closed by someone
+// else. This includes timeouts: the late reply would otherwise still be
+// waiting on the connection for the next call to read. The call that
+// hits the failure still fails. The connection is only reopened when the
+// next request starts, with the first Write after a Flush or after the
+// failure, which ends the call that saw it, so a message is never split
+// across connections. While reopening keeps failing, requests
+// fail with NOT_OPEN without another attempt until the backoff has passed.
+//
+// Wrap it in the framed or buffered transport used by the client. Like the
+// transport it wraps, it is not safe for concurrent use.
+type TReconnectingTransport struct {
+	trans       TTransport
+	options     TReconnectOptions
+	open        bool
+	broken      bool
+	sending     bool
+	attempts    int
+	backoff     time.Duration
+	nextAttempt time.Time
+	lastErr     error
+}
+
+func NewTReconnectingTransport(trans TTransport, options TReconnectOptions) *TReconnectingTransport {
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = DEFAULT_RECONNECT_MIN_BACKOFF
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = DEFAULT_RECONNECT_MAX_BACKOFF
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = options.MinBackoff
+	}
+	return &TReconnectingTransport{trans: trans, options: options, open: trans.IsOpen()}
+}
+
+// Returns the wrapped transport.
+func (p *TReconnectingTransport) Transport() TTransport {
+	return p.trans
+}
+
+// Opens the underlying transport. Failures of this first Open are returned
+// as they are and are not retried.
+func (p *TReconnectingTransport) Open() error {
+	if p.open {
+		return NewTTransportException(ALREADY_OPEN, "Transport already open")
+	}
+	if err := p.trans.Open(); err != nil {
+		return err
+	}
+	p.open, p.broken, p.sending, p.attempts = true, false, false, 0
+	return nil
+}
+
+// Reports whether the transport is in use, i.e. opened and not closed. The
+// connection itself may be broken and awaiting the next request.
+func (p *TReconnectingTransport) IsOpen() bool {
+	return p.open
+}
+
+// Closes the underlying transport. It is not reopened until Open is called.
+func (p *TReconnectingTransport) Close() error {
+	p.open = false
+	return p.trans.Close()
+}
+
+func (p *TReconnectingTransport) Read(buf []byte) (int, error) {
+	if err := p.check(); err != nil {
+		return 0, err
+	}
+	n, err := p.trans.Read(buf)
+	p.failed(err)
+	return n, err
+}
+
+func (p *TReconnectingTransport) Write(buf []byte) (int, error) {
+	if !p.sending {
+		if err := p.reconnect(); err != nil {
+			return 0, err
+		}
+		p.sending = true
+	}
+	if err := p.check(); err != nil {
+		return 0, err
+	}
+	n, err := p.trans.Write(buf)
+	p.failed(err)
+	return n, err
+}
+
+// Sends the request and ends it, so that the next Write may reconnect.
+func (p *TReconnectingTransport) Flush() error {
+	p.sending = false
+	if err := p.check(); err != nil {
+		return err
+	}
+	err := p.trans.Flush()
+	p.failed(err)
+	return err
+}
+
+func (p *TReconnectingTransport) Peek() bool {
+	return p.open && !p.broken && p.trans.Peek()
+}
+
+// Returns NOT_OPEN if the connection cannot be used before reconnecting.
+func (p *TReconnectingTransport) check() error {
+	if !p.open {
+		return NewTTransportException(NOT_OPEN, "Transport not open")
+	}
+	if !p.broken && !p.trans.IsOpen() {
+		p.disconnect(NewTTransportException(NOT_OPEN, "Transport closed"))
+	}
+	if p.broken {
+		return NewTTransportException(NOT_OPEN, "Connection broken: "+p.lastErr.Error())
+	}
+	return nil
+}
+
+// Marks the connection broken after a failed read or write. The request in
+// progress cannot be completed on it, and what is left of it or of its reply
+// would end up in the next one.
+func (p *TReconnectingTransport) failed(err error) {
+	if err != nil {
+		p.disconnect(err)
+	}
+}
+
+func (p *TReconnectingTransport) disconnect(err error) {
+	p.broken, p.sending, p.lastErr = true, false, err
+	p.attempts, p.backoff, p.nextAttempt = 0, 0, time.Time{}
+	p.trans.Close()
+	p.event(DISCONNECTED, err)
+}
+
+// Reopens a broken connection at the start of a request, unless the backoff
+// of the last failed attempt has not passed yet.
+func (p *TReconnectingTransport) reconnect() error {
+	if err := p.check(); !p.broken {
+		return err
+	}
+	if time.Now().Before(p.nextAttempt) {
+		return NewTTransportException(NOT_OPEN, "Reconnect backing off: "+p.lastErr.Error())
+	}
+	p.attempts++
+	p.trans.Close()
+	if err := p.trans.Open(); err != nil {
+		if p.backoff == 0 {
+			p.backoff = p.options.MinBackoff
+		} else if p.backoff *= 2; p.backoff > p.options.MaxBackoff {
+			p.backoff = p.options.MaxBackoff
+		}
+		p.nextAttempt = time.Now().Add(p.backoff)
+		p.lastErr = err
+		p.event(RECONNECT_FAILED, err)
+		return NewTTransportException(NOT_OPEN, "Reconnect failed: "+err.Error())
+	}
+	p.broken = false
+	p.event(RECONNECTED, nil)
+	return nil
+}
+
+func (p *TReconnectingTransport) event(typ TReconnectEventType, err error) {
+	if p.options.OnEvent != nil {
+		p.options.OnEvent(TReconnectEvent{Type: typ, Attempt: p.attempts, Err: err})
+	}
+}
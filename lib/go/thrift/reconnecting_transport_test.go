@@ -0,0 +1,180 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testReconnectEvents []TReconnectEvent
+
+func (p *testReconnectEvents) record(event TReconnectEvent) {
+	*p = append(*p, event)
+}
+
+func (p testReconnectEvents) types() []TReconnectEventType {
+	types := make([]TReconnectEventType, len(p))
+	for i, event := range p {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestReconnectingTransport(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewTSimpleServer4(&testEchoProcessor{}, NewTServerSocketFromListener(l, 0),
+		NewTFramedTransportFactory(NewTTransportFactory()), NewTBinaryProtocolFactoryDefault())
+	server.SetLogger(NopLogger)
+	// Every connection is closed after one call, so every other call breaks.
+	server.SetMaxRequestsPerConnection(1)
+	go server.Serve()
+	defer server.Stop()
+
+	var events testReconnectEvents
+	socket, err := NewTSocketTimeout(l.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans := NewTReconnectingTransport(socket, TReconnectOptions{OnEvent: events.record})
+	client := NewTFramedTransport(trans)
+	if err := client.Open(); err != nil {
+		t.Fatalf("Unable to open transport: %s", err)
+	}
+	defer client.Close()
+
+	if err := callTestEcho(client, 1); err != nil {
+		t.Fatalf("First call failed: %s", err)
+	}
+	if err := callTestEcho(client, 2); err == nil {
+		t.Fatal("Expected the call on the closed connection to fail")
+	}
+	if err := callTestEcho(client, 3); err != nil {
+		t.Fatalf("Call after reconnecting failed: %s", err)
+	}
+	expected := []TReconnectEventType{DISCONNECTED, RECONNECTED}
+	if types := events.types(); len(types) != 2 || types[0] != expected[0] || types[1] != expected[1] {
+		t.Fatalf("Expected events %v, got %v", expected, types)
+	}
+	if events[1].Attempt != 1 {
+		t.Fatalf("Expected the first attempt to succeed, got %d", events[1].Attempt)
+	}
+}
+
+// The reply to a call that timed out must not be read by the next call.
+func TestReconnectingTransportTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int32
+	slowFirst := func(next ProcessorHandler) ProcessorHandler {
+		return func(call *TCallInfo, in, out TProtocol) (bool, TException) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				time.Sleep(200 * time.Millisecond)
+			}
+			return next(call, in, out)
+		}
+	}
+	server := NewTSimpleServer4(WrapProcessor(&testEchoProcessor{}, slowFirst), NewTServerSocketFromListener(l, 0),
+		NewTFramedTransportFactory(NewTTransportFactory()), NewTBinaryProtocolFactoryDefault())
+	server.SetLogger(NopLogger)
+	go server.Serve()
+	defer server.Stop()
+
+	var events testReconnectEvents
+	socket, err := NewTSocketTimeout(l.Addr().String(), 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewTFramedTransport(NewTReconnectingTransport(socket, TReconnectOptions{OnEvent: events.record}))
+	if err := client.Open(); err != nil {
+		t.Fatalf("Unable to open transport: %s", err)
+	}
+	defer client.Close()
+
+	err = callTestEcho(client, 1)
+	if e, ok := err.(TTransportException); !ok || e.TypeId() != TIMED_OUT {
+		t.Fatalf("Expected the first call to time out, got %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if err := callTestEcho(client, 2); err != nil {
+		t.Fatalf("Call after the timeout failed: %s", err)
+	}
+	if types := events.types(); len(types) != 2 || types[0] != DISCONNECTED || types[1] != RECONNECTED {
+		t.Fatalf("Unexpected events %v", types)
+	}
+}
+
+func TestReconnectingTransportBackoff(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			conn.Close()
+		}
+		l.Close()
+	}()
+
+	var events testReconnectEvents
+	socket, err := NewTSocketTimeout(l.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans := NewTReconnectingTransport(socket, TReconnectOptions{MinBackoff: time.Hour, OnEvent: events.record})
+	if err := trans.Open(); err != nil {
+		t.Fatalf("Unable to open transport: %s", err)
+	}
+	if _, err := trans.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Expected the read from the closed connection to fail")
+	}
+	if trans.Peek() {
+		t.Fatal("Expected a broken connection not to peek")
+	}
+
+	// The listener is gone, so the first attempt fails and the next request
+	// fails fast until the backoff has passed.
+	if _, err := trans.Write([]byte{1}); err == nil || !strings.Contains(err.Error(), "Reconnect failed") {
+		t.Fatalf("Expected the reconnect to fail, got %v", err)
+	}
+	if _, err := trans.Write([]byte{1}); err == nil || !strings.Contains(err.Error(), "backing off") {
+		t.Fatalf("Expected the reconnect to back off, got %v", err)
+	}
+	if types := events.types(); len(types) != 2 || types[0] != DISCONNECTED || types[1] != RECONNECT_FAILED {
+		t.Fatalf("Unexpected events %v", types)
+	}
+
+	trans.Close()
+	_, err = trans.Write([]byte{1})
+	if e, ok := err.(TTransportException); !ok || e.TypeId() != NOT_OPEN {
+		t.Fatalf("Expected NOT_OPEN after Close, got %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected no reconnect after Close, got %v", events.types())
+	}
+}
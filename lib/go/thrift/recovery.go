@@ -0,0 +1,97 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// tHeaderRecordingProtocol remembers the last message header read through
+// it, so that a server can still reply to a message whose processor
+// panicked.
+type tHeaderRecordingProtocol struct {
+	TProtocolDecorator
+	name   string
+	typeId TMessageType
+	seqId  int32
+}
+
+func newTHeaderRecordingProtocol(p TProtocol) *tHeaderRecordingProtocol {
+	return &tHeaderRecordingProtocol{TProtocolDecorator: NewTProtocolDecorator(p)}
+}
+
+func (p *tHeaderRecordingProtocol) ReadMessageBegin() (name string, typeId TMessageType, seqid int32, err error) {
+	name, typeId, seqid, err = p.concreteProtocol.ReadMessageBegin()
+	if err == nil {
+		p.name, p.typeId, p.seqId = name, typeId, seqid
+	}
+	return
+}
+
+// Forgets the recorded header before the next message is processed.
+func (p *tHeaderRecordingProtocol) reset() {
+	p.name, p.typeId, p.seqId = "", INVALID_TMESSAGE_TYPE, 0
+}
+
+// recoverHandlerPanic logs a recovered panic with its stack and, if the
+// message was a CALL, writes an INTERNAL_ERROR reply carrying seqId to out.
+// The returned exception is meant to be reported as the processing error.
+func recoverHandlerPanic(logger Logger, r interface{}, name string, typeId TMessageType, seqId int32, out TProtocol) TException {
+	if index := strings.Index(name, SEPARATOR); index >= 0 {
+		name = name[index+1:]
+	}
+	logger(fmt.Sprintf("panic processing %q (seqid %d): %v\n%s", name, seqId, r, debug.Stack()))
+	x := NewTApplicationException(INTERNAL_ERROR, fmt.Sprintf("Internal error processing %s: %v", name, r))
+	if typeId == CALL && out != nil {
+		if err := out.WriteMessageBegin(name, EXCEPTION, seqId); err != nil {
+			return x
+		}
+		if err := x.Write(out); err != nil {
+			return x
+		}
+		if err := out.WriteMessageEnd(); err != nil {
+			return x
+		}
+		out.Flush()
+	}
+	return x
+}
+
+// NewRecoveryProcessorMiddleware recovers panics raised further down the
+// chain. The panic and its stack are logged, an INTERNAL_ERROR reply is
+// written when the call expects one, and the panic is reported as the
+// processing error so that the server drops the connection.
+func NewRecoveryProcessorMiddleware(logger Logger) ProcessorMiddleware {
+	if logger == nil {
+		logger = StdLogger(nil)
+	}
+	return func(next ProcessorHandler) ProcessorHandler {
+		return func(call *TCallInfo, in, out TProtocol) (ok bool, err TException) {
+			defer func() {
+				if r := recover(); r != nil {
+					ok, err = false, recoverHandlerPanic(logger, r, call.Method, call.TypeId, call.SeqId, out)
+				}
+			}()
+			return next(call, in, out)
+		}
+	}
+}
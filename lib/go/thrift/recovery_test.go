@@ -0,0 +1,91 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type testPanicProcessor struct{}
+
+func (p *testPanicProcessor) Process(in, out TProtocol) (bool, TException) {
+	in.ReadMessageBegin()
+	(&testCallStruct{}).Read(in)
+	in.ReadMessageEnd()
+	panic("handler exploded")
+}
+
+func expectInternalError(t *testing.T, buf *bytes.Buffer, seqId int32) {
+	err := new(TStandardClient).Recv(NewTBinaryProtocolTransport(NewStreamTransportR(buf)), seqId, "echo", &testCallStruct{})
+	e, ok := err.(TApplicationException)
+	if !ok || e.TypeId() != INTERNAL_ERROR {
+		t.Fatalf("Expected INTERNAL_ERROR reply but got %v", err)
+	}
+	if !strings.Contains(e.Error(), "handler exploded") {
+		t.Fatalf("Unexpected exception message %q", e.Error())
+	}
+}
+
+func TestSimpleServerRecoversPanic(t *testing.T) {
+	in := NewTMemoryBuffer()
+	writeTestCall(t, in, "echo", 5, 1)
+	out := &bytes.Buffer{}
+	var lines []string
+
+	server := NewTSimpleServer2(&testPanicProcessor{}, nil)
+	server.SetLogger(func(msg string) { lines = append(lines, msg) })
+	err := server.processRequest(NewStreamTransport(in, out))
+	if e, ok := err.(TApplicationException); !ok || e.TypeId() != INTERNAL_ERROR {
+		t.Fatalf("Expected INTERNAL_ERROR from processRequest() but got %v", err)
+	}
+	if len(lines) != 1 || !strings.Contains(lines[0], "goroutine") {
+		t.Fatalf("Expected the panic stack to be logged, got %v", lines)
+	}
+	expectInternalError(t, out, 5)
+}
+
+func TestSimpleServerRecoversOnewayPanic(t *testing.T) {
+	in := NewTMemoryBuffer()
+	writeTestReply(t, NewTBinaryProtocolTransport(in), "echo", ONEWAY, 5, &testCallStruct{})
+	out := &bytes.Buffer{}
+
+	server := NewTSimpleServer2(&testPanicProcessor{}, nil)
+	server.SetLogger(NopLogger)
+	if err := server.processRequest(NewStreamTransport(in, out)); err == nil {
+		t.Fatalf("Expected error from processRequest()")
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Expected no reply to a oneway message, got %d bytes", out.Len())
+	}
+}
+
+func TestRecoveryProcessorMiddleware(t *testing.T) {
+	in := NewTMemoryBuffer()
+	writeTestCall(t, in, "echo", 9, 1)
+	out := &bytes.Buffer{}
+	processor := WrapProcessor(&testPanicProcessor{}, NewRecoveryProcessorMiddleware(NopLogger))
+	oprot := NewTBinaryProtocolTransport(NewStreamTransportW(out))
+	if ok, err := processor.Process(NewTBinaryProtocolTransport(in), oprot); ok || err == nil {
+		t.Fatalf("Expected Process() to report the panic")
+	}
+	expectInternalError(t, out, 9)
+}
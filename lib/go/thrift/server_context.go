@@ -0,0 +1,162 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"reflect"
+	"sync"
+)
+
+// TConnectionContext holds the state of one client connection. Servers
+// create it when a connection is accepted and drop it when the connection
+// is closed. Besides the addresses and TLS state filled in by the server it
+// carries arbitrary values, such as an authenticated identity, set by a
+// TServerEventHandler or a processor middleware.
+type TConnectionContext struct {
+	RemoteAddr net.Addr
+	LocalAddr  net.Addr
+	// State of the TLS connection after the handshake, nil for plain
+	// connections.
+	TLSState *tls.ConnectionState
+
+	mu     sync.RWMutex
+	values map[interface{}]interface{}
+}
+
+// Transports running over TLS, such as TSSLSocket.
+type tlsTransport interface {
+	Handshake() error
+	ConnectionState() tls.ConnectionState
+}
+
+// Builds the context of a newly accepted client. For TLS transports the
+// handshake is completed first, so that the peer certificates are known.
+func newTConnectionContext(client TTransport) (*TConnectionContext, error) {
+	ctx := &TConnectionContext{}
+	if c, ok := client.(interface {
+		Conn() net.Conn
+	}); ok && c.Conn() != nil {
+		ctx.RemoteAddr = c.Conn().RemoteAddr()
+		ctx.LocalAddr = c.Conn().LocalAddr()
+	}
+	if t, ok := client.(tlsTransport); ok {
+		if err := t.Handshake(); err != nil {
+			return nil, NewTTransportExceptionFromError(err)
+		}
+		state := t.ConnectionState()
+		ctx.TLSState = &state
+	}
+	return ctx, nil
+}
+
+// PeerCertificate returns the leaf of the first verified certificate chain
+// presented by the peer, or nil if the peer was not verified.
+func (c *TConnectionContext) PeerCertificate() *x509.Certificate {
+	if c.TLSState == nil || len(c.TLSState.VerifiedChains) == 0 || len(c.TLSState.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return c.TLSState.VerifiedChains[0][0]
+}
+
+// Stores a value under key for the lifetime of the connection.
+func (c *TConnectionContext) Set(key, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[interface{}]interface{})
+	}
+	c.values[key] = value
+}
+
+// Returns the value stored under key, or nil.
+func (c *TConnectionContext) Value(key interface{}) interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.values[key]
+}
+
+// Connection contexts of the transports currently being served, so that
+// processor factories and middleware can find them from the transport they
+// are handed.
+var connectionContexts = struct {
+	sync.RWMutex
+	m map[TTransport]*TConnectionContext
+}{m: make(map[TTransport]*TConnectionContext)}
+
+func registerConnectionContext(ctx *TConnectionContext, transports ...TTransport) {
+	connectionContexts.Lock()
+	defer connectionContexts.Unlock()
+	for _, trans := range transports {
+		if trans != nil && reflect.TypeOf(trans).Comparable() {
+			connectionContexts.m[trans] = ctx
+		}
+	}
+}
+
+func unregisterConnectionContext(transports ...TTransport) {
+	connectionContexts.Lock()
+	defer connectionContexts.Unlock()
+	for _, trans := range transports {
+		if trans != nil && reflect.TypeOf(trans).Comparable() {
+			delete(connectionContexts.m, trans)
+		}
+	}
+}
+
+// GetConnectionContext returns the context of the connection trans belongs
+// to. trans may be the client transport passed to
+// TProcessorFactory.GetProcessor or the transport of one of the protocols
+// passed to TProcessor.Process.
+func GetConnectionContext(trans TTransport) (*TConnectionContext, bool) {
+	if trans == nil || !reflect.TypeOf(trans).Comparable() {
+		return nil, false
+	}
+	connectionContexts.RLock()
+	defer connectionContexts.RUnlock()
+	ctx, ok := connectionContexts.m[trans]
+	return ctx, ok
+}
+
+// TServerEventHandler receives notifications about the lifecycle of a
+// server and of its connections.
+type TServerEventHandler interface {
+	// Called once the server is listening, before the first connection is
+	// accepted.
+	PreServe()
+	// Called when a connection has been accepted and its protocols have
+	// been created. The handler may populate ctx.
+	CreateContext(ctx *TConnectionContext, in, out TProtocol)
+	// Called when the connection is about to be closed.
+	DeleteContext(ctx *TConnectionContext, in, out TProtocol)
+	// Called before each message of the connection is processed.
+	ProcessContext(ctx *TConnectionContext, client TTransport)
+}
+
+// TServerEventHandlerBase implements TServerEventHandler with no-ops, for
+// embedding in handlers that only need some of the hooks.
+type TServerEventHandlerBase struct{}
+
+func (TServerEventHandlerBase) PreServe()                                                 {}
+func (TServerEventHandlerBase) CreateContext(ctx *TConnectionContext, in, out TProtocol)  {}
+func (TServerEventHandlerBase) DeleteContext(ctx *TConnectionContext, in, out TProtocol)  {}
+func (TServerEventHandlerBase) ProcessContext(ctx *TConnectionContext, client TTransport) {}
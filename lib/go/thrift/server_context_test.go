@@ -0,0 +1,125 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testEventHandler struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (h *testEventHandler) record(event string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, event)
+}
+
+func (h *testEventHandler) recorded() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.events...)
+}
+
+func (h *testEventHandler) PreServe() {
+	h.record("PreServe")
+}
+
+func (h *testEventHandler) CreateContext(ctx *TConnectionContext, in, out TProtocol) {
+	ctx.Set("identity", "alice")
+	h.record("CreateContext")
+}
+
+func (h *testEventHandler) DeleteContext(ctx *TConnectionContext, in, out TProtocol) {
+	h.record("DeleteContext")
+}
+
+func (h *testEventHandler) ProcessContext(ctx *TConnectionContext, client TTransport) {
+	h.record("ProcessContext")
+}
+
+// Processor that replies to "echo" with the length of the identity stored
+// in its connection context.
+type testIdentityProcessor struct {
+	t *testing.T
+}
+
+func (p *testIdentityProcessor) Process(in, out TProtocol) (bool, TException) {
+	ctx, ok := GetConnectionContext(in.Transport())
+	if !ok {
+		p.t.Fatalf("No connection context for %T", in.Transport())
+	}
+	identity, _ := ctx.Value("identity").(string)
+	_, _, seqId, err := in.ReadMessageBegin()
+	if err != nil {
+		return false, err
+	}
+	(&testCallStruct{}).Read(in)
+	in.ReadMessageEnd()
+	out.WriteMessageBegin("echo", REPLY, seqId)
+	(&testCallStruct{int32(len(identity))}).Write(out)
+	out.WriteMessageEnd()
+	return true, out.Flush()
+}
+
+func TestSimpleServerEventHandler(t *testing.T) {
+	in := NewTMemoryBuffer()
+	writeTestCall(t, in, "echo", 1, 0)
+	writeTestCall(t, in, "echo", 2, 0)
+	out := &bytes.Buffer{}
+	handler := &testEventHandler{}
+	client := NewStreamTransport(in, out)
+
+	server := NewTSimpleServer2(&testIdentityProcessor{t}, nil)
+	server.SetServerEventHandler(handler)
+	if err := server.processRequest(client); err != nil {
+		t.Fatalf("processRequest() failed: %s", err)
+	}
+	expected := "CreateContext,ProcessContext,ProcessContext,ProcessContext,DeleteContext"
+	if strings.Join(handler.recorded(), ",") != expected {
+		t.Fatalf("Expected events %s but got %v", expected, handler.recorded())
+	}
+	result := &testCallStruct{}
+	if err := new(TStandardClient).Recv(NewTBinaryProtocolTransport(NewStreamTransportR(out)), 1, "echo", result); err != nil {
+		t.Fatalf("Recv() failed: %s", err)
+	}
+	if result.Value != int32(len("alice")) {
+		t.Fatalf("Handler did not see the connection context value")
+	}
+	if _, ok := GetConnectionContext(client); ok {
+		t.Fatalf("Connection context was not released")
+	}
+}
+
+func TestConnectionContextValues(t *testing.T) {
+	ctx := &TConnectionContext{}
+	if ctx.Value("missing") != nil {
+		t.Fatalf("Expected nil for a missing value")
+	}
+	ctx.Set("key", 1)
+	if ctx.Value("key") != 1 {
+		t.Fatalf("Expected stored value 1 but got %v", ctx.Value("key"))
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"time"
+)
+
+// Implemented by transports whose reads can be given an absolute deadline,
+// such as TSocket and TSSLSocket.
+type tReadDeadliner interface {
+	setReadDeadline(t time.Time)
+}
+
+// tMessageDeadlineTransport sets the read deadlines of a server connection.
+// Waiting for a message and reading its header is limited by idleTimeout,
+// and reading the rest of it by messageTimeout, counted from the end of the
+// header. A zero timeout leaves the phase to the socket timeout. The phases
+// are switched by the server and by the protocol returned by protocol, not
+// by the bytes read, as buffered and framed transports read ahead.
+type tMessageDeadlineTransport struct {
+	TTransport
+	deadliner      tReadDeadliner
+	idleTimeout    time.Duration
+	messageTimeout time.Duration
+	reading        bool
+	idle           bool
+}
+
+// Wraps trans, or returns nil if its deadlines cannot be set.
+func newTMessageDeadlineTransport(trans TTransport, idleTimeout, messageTimeout time.Duration) *tMessageDeadlineTransport {
+	deadliner, ok := trans.(tReadDeadliner)
+	if !ok {
+		return nil
+	}
+	return &tMessageDeadlineTransport{
+		TTransport:     trans,
+		deadliner:      deadliner,
+		idleTimeout:    idleTimeout,
+		messageTimeout: messageTimeout,
+	}
+}
+
+// Starts waiting for the next message.
+func (p *tMessageDeadlineTransport) nextMessage() {
+	p.reading = false
+	p.deadliner.setReadDeadline(deadlineAfter(p.idleTimeout))
+}
+
+// Starts reading the rest of a message whose header has been read.
+func (p *tMessageDeadlineTransport) messageStarted() {
+	p.reading = true
+	p.deadliner.setReadDeadline(deadlineAfter(p.messageTimeout))
+}
+
+// Reports whether the connection timed out waiting for a message.
+func (p *tMessageDeadlineTransport) idleExpired() bool {
+	return p.idle
+}
+
+// Wraps the input protocol of the connection to start the message phase
+// once a message header has been read.
+func (p *tMessageDeadlineTransport) protocol(prot TProtocol) TProtocol {
+	return &tMessageDeadlineProtocol{TProtocolDecorator: NewTProtocolDecorator(prot), deadlines: p}
+}
+
+func (p *tMessageDeadlineTransport) Read(buf []byte) (int, error) {
+	n, err := p.TTransport.Read(buf)
+	if x, ok := err.(TTransportException); ok && x.TypeId() == TIMED_OUT && !p.reading && p.idleTimeout > 0 {
+		p.idle = true
+	}
+	return n, err
+}
+
+type tMessageDeadlineProtocol struct {
+	TProtocolDecorator
+	deadlines *tMessageDeadlineTransport
+}
+
+func (p *tMessageDeadlineProtocol) ReadMessageBegin() (name string, typeId TMessageType, seqid int32, err error) {
+	name, typeId, seqid, err = p.concreteProtocol.ReadMessageBegin()
+	if err == nil {
+		p.deadlines.messageStarted()
+	}
+	return
+}
+
+// Returns the time d from now, or the zero time if d is not positive.
+func deadlineAfter(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
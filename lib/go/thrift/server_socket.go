@@ -21,6 +21,7 @@ package thrift
 
 import (
 	"net"
+	"sync"
 	"time"
 )
 
@@ -29,6 +30,9 @@ type TServerSocket struct {
 	addr          net.Addr
 	clientTimeout time.Duration
 	interrupted   bool
+	// Guards listener and interrupted, which Stop and Close change while
+	// Serve is accepting.
+	mu sync.RWMutex
 }
 
 func NewTServerSocket(listenAddr string) (*TServerSocket, error) {
@@ -43,8 +47,17 @@ func NewTServerSocketTimeout(listenAddr string, clientTimeout time.Duration) (*T
 	return &TServerSocket{addr: addr, clientTimeout: clientTimeout}, nil
 }
 
+// Creates a TServerSocket accepting connections from an existing listener,
+// such as one inherited through socket activation. The server socket takes
+// ownership of l and closes it on Close.
+func NewTServerSocketFromListener(l net.Listener, clientTimeout time.Duration) *TServerSocket {
+	return &TServerSocket{listener: l, addr: l.Addr(), clientTimeout: clientTimeout}
+}
+
 func (p *TServerSocket) Listen() error {
-	if p.IsListening() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listener != nil {
 		return nil
 	}
 	l, err := net.Listen(p.addr.Network(), p.addr.String())
@@ -56,13 +69,16 @@ func (p *TServerSocket) Listen() error {
 }
 
 func (p *TServerSocket) Accept() (TTransport, error) {
-	if p.interrupted {
+	p.mu.RLock()
+	interrupted, listener := p.interrupted, p.listener
+	p.mu.RUnlock()
+	if interrupted {
 		return nil, errTransportInterrupted
 	}
-	if p.listener == nil {
+	if listener == nil {
 		return nil, NewTTransportException(NOT_OPEN, "No underlying server socket")
 	}
-	conn, err := p.listener.Accept()
+	conn, err := listener.Accept()
 	if err != nil {
 		return nil, NewTTransportExceptionFromError(err)
 	}
@@ -71,12 +87,16 @@ func (p *TServerSocket) Accept() (TTransport, error) {
 
 // Checks whether the socket is listening.
 func (p *TServerSocket) IsListening() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return p.listener != nil
 }
 
 // Connects the socket, creating a new socket object if necessary.
 func (p *TServerSocket) Open() error {
-	if p.IsListening() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listener != nil {
 		return NewTTransportException(ALREADY_OPEN, "Server socket already open")
 	}
 	if l, err := net.Listen(p.addr.Network(), p.addr.String()); err != nil {
@@ -92,16 +112,20 @@ func (p *TServerSocket) Addr() net.Addr {
 }
 
 func (p *TServerSocket) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	defer func() {
 		p.listener = nil
 	}()
-	if p.IsListening() {
+	if p.listener != nil {
 		return p.listener.Close()
 	}
 	return nil
 }
 
 func (p *TServerSocket) Interrupt() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.interrupted = true
 	return nil
 }
@@ -20,9 +20,123 @@
 package thrift
 
 import (
+	"fmt"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestNothing(t *testing.T) {
 
 }
+
+// Serves one net.Pipe connection with server and returns the client side
+// and the result of processRequest.
+func serveTestPipe(t *testing.T, server *TSimpleServer) (TTransport, chan error) {
+	serverConn, clientConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- server.processRequest(NewTSocketFromConnTimeout(serverConn, 0))
+	}()
+	client := NewTSocketFromConnTimeout(clientConn, 5*time.Second)
+	t.Cleanup(func() { client.Close() })
+	return client, done
+}
+
+func callTestEcho(trans TTransport, value int32) error {
+	p := NewTBinaryProtocolTransport(trans)
+	result := &testCallStruct{}
+	if err := NewTStandardClient(p, p).Call("echo", &testCallStruct{value}, result); err != nil {
+		return err
+	}
+	if result.Value != value {
+		return fmt.Errorf("Expected %d, got %d", value, result.Value)
+	}
+	return nil
+}
+
+func waitTestServed(t *testing.T, done chan error) error {
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Connection still served")
+		return nil
+	}
+}
+
+func TestSimpleServerMaxRequestsPerConnection(t *testing.T) {
+	server := NewTSimpleServer2(&testEchoProcessor{}, nil)
+	server.SetMaxRequestsPerConnection(2)
+	client, done := serveTestPipe(t, server)
+	for i := int32(0); i < 2; i++ {
+		if err := callTestEcho(client, i); err != nil {
+			t.Fatalf("Call %d failed: %s", i, err)
+		}
+	}
+	if err := waitTestServed(t, done); err != nil {
+		t.Fatalf("Expected a clean close, got %s", err)
+	}
+	if err := callTestEcho(client, 3); err == nil {
+		t.Fatal("Expected the connection to be closed")
+	}
+}
+
+func TestSimpleServerIdleTimeout(t *testing.T) {
+	server := NewTSimpleServer2(&testEchoProcessor{}, nil)
+	server.SetIdleTimeout(50 * time.Millisecond)
+	client, done := serveTestPipe(t, server)
+	if err := callTestEcho(client, 1); err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	if err := waitTestServed(t, done); err != nil {
+		t.Fatalf("Expected a clean close, got %s", err)
+	}
+}
+
+func TestSimpleServerMessageTimeout(t *testing.T) {
+	server := NewTSimpleServer2(&testEchoProcessor{}, nil)
+	server.SetLogger(NopLogger)
+	server.SetMessageTimeout(50 * time.Millisecond)
+	client, done := serveTestPipe(t, server)
+	// Idling between messages is not limited by the message timeout.
+	time.Sleep(100 * time.Millisecond)
+	if err := callTestEcho(client, 1); err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+
+	buf := NewTMemoryBuffer()
+	writeTestCall(t, buf, "echo", 2, 2)
+	if _, err := client.Write(buf.Bytes()[:buf.Len()-3]); err != nil {
+		t.Fatal(err)
+	}
+	err := waitTestServed(t, done)
+	if e, ok := err.(TTransportException); !ok || e.TypeId() != TIMED_OUT {
+		t.Fatalf("Expected TIMED_OUT, got %v", err)
+	}
+}
+
+// A buffered input transport reads the start of the next message along with
+// the current one; the rest of it is still limited by the message timeout.
+func TestSimpleServerMessageTimeoutBuffered(t *testing.T) {
+	binary := NewTBinaryProtocolFactoryDefault()
+	server := NewTSimpleServer4(&testEchoProcessor{}, nil, NewTBufferedTransportFactory(4096), binary)
+	server.SetLogger(NopLogger)
+	server.SetMessageTimeout(50 * time.Millisecond)
+	client, done := serveTestPipe(t, server)
+
+	buf := NewTMemoryBuffer()
+	writeTestCall(t, buf, "echo", 1, 1)
+	writeTestCall(t, buf, "echo", 2, 2)
+	if _, err := client.Write(buf.Bytes()[:buf.Len()-3]); err != nil {
+		t.Fatal(err)
+	}
+	result := &testCallStruct{}
+	if err := new(TStandardClient).Recv(NewTBinaryProtocolTransport(client), 1, "echo", result); err != nil || result.Value != 1 {
+		t.Fatalf("Expected 1, got %d and %v", result.Value, err)
+	}
+	err := waitTestServed(t, done)
+	if e, ok := err.(TTransportException); !ok || e.TypeId() != TIMED_OUT {
+		t.Fatalf("Expected TIMED_OUT, got %v", err)
+	}
+}
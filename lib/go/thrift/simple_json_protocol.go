@@ -139,10 +139,36 @@ func init() {
 	json_nonbase_map_elem_bytes = []byte{']', ',', '['}
 }
 
+// Quotes s like the other Thrift libraries do: only quotes, backslashes and
+// control characters are escaped.
 func jsonQuote(s string) string {
-	b, _ := json.Marshal(s)
-	s1 := string(b)
-	return s1
+	const hex = "0123456789abcdef"
+	b := make([]byte, 0, len(s)+2)
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"', '\\':
+			b = append(b, '\\', c)
+		case '\b':
+			b = append(b, '\\', 'b')
+		case '\f':
+			b = append(b, '\\', 'f')
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		default:
+			if c < 0x20 {
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+	return string(append(b, '"'))
 }
 
 func jsonUnquote(s string) (string, bool) {
@@ -386,6 +412,9 @@ func (p *TSimpleJSONProtocol) ReadMapBegin() (keyType TType, valueType TType, si
 	// read size
 	iSize, err := p.ReadI64()
 	size = int(iSize)
+	if err == nil {
+		err = p.checkContainerSize(size)
+	}
 	return keyType, valueType, size, err
 }
 
@@ -788,10 +817,16 @@ func (p *TSimpleJSONProtocol) ParsePreValue() error {
 }
 
 func (p *TSimpleJSONProtocol) ParsePostValue() error {
+	cxt := _ParseContext(p.parseContextStack[len(p.parseContextStack)-1])
+	if cxt == _CONTEXT_IN_TOPLEVEL {
+		// Nothing follows a complete top level value within the message;
+		// peeking here would block on stream transports until the peer
+		// sends its next message.
+		return nil
+	}
 	if e := p.readNonSignificantWhitespace(); e != nil {
 		return NewTProtocolException(e)
 	}
-	cxt := _ParseContext(p.parseContextStack[len(p.parseContextStack)-1])
 	switch cxt {
 	case _CONTEXT_IN_LIST_FIRST:
 		p.parseContextStack = p.parseContextStack[:len(p.parseContextStack)-1]
@@ -889,10 +924,11 @@ func (p *TSimpleJSONProtocol) ParseBase64EncodedBody() ([]byte, error) {
 	if err != nil {
 		return line, NewTProtocolException(err)
 	}
-	line2 := line[0 : len(line)-1]
+	// accept both padded and unpadded input
+	line2 := bytes.TrimRight(line[0:len(line)-1], "=")
 	l := len(line2)
-	output := make([]byte, base64.StdEncoding.DecodedLen(l))
-	n, err := base64.StdEncoding.Decode(output, line2)
+	output := make([]byte, base64.RawStdEncoding.DecodedLen(l))
+	n, err := base64.RawStdEncoding.Decode(output, line2)
 	return output[0:n], NewTProtocolException(err)
 }
 
@@ -1017,9 +1053,22 @@ func (p *TSimpleJSONProtocol) ParseElemListBegin() (elemType TType, size int, e
 	}
 	nSize, err2 := p.ReadI64()
 	size = int(nSize)
+	if err2 == nil {
+		err2 = p.checkContainerSize(size)
+	}
 	return elemType, size, err2
 }
 
+// Checks a container size read from the wire, counting the buffered input
+// as remaining bytes.
+func (p *TSimpleJSONProtocol) checkContainerSize(size int) error {
+	remaining := remainingBytes(p.trans)
+	if remaining >= 0 {
+		remaining += p.reader.Buffered()
+	}
+	return checkReadSize(size, MaxContainerSize, remaining)
+}
+
 func (p *TSimpleJSONProtocol) ParseListEnd() error {
 	if isNull, err := p.readIfNull(); isNull || err != nil {
 		return err
@@ -23,10 +23,12 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestWriteSimpleJSONProtocolBool(t *testing.T) {
@@ -630,3 +632,42 @@ func TestWriteSimpleJSONProtocolMap(t *testing.T) {
 	}
 	trans.Close()
 }
+
+// The end of a message must not wait for the peer to send the next one.
+func TestReadJSONProtocolMessageEndOnStream(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	go func() {
+		p := NewTJSONProtocol(NewStreamTransportW(w))
+		p.WriteMessageBegin("echo", CALL, 1)
+		p.WriteStructBegin("echo_args")
+		p.WriteFieldBegin("value", I32, 1)
+		p.WriteI32(1)
+		p.WriteFieldEnd()
+		p.WriteFieldStop()
+		p.WriteStructEnd()
+		p.WriteMessageEnd()
+		p.Flush()
+	}()
+	p := NewTJSONProtocol(NewStreamTransportR(r))
+	done := make(chan error, 1)
+	go func() {
+		if _, _, _, err := p.ReadMessageBegin(); err != nil {
+			done <- err
+			return
+		}
+		if err := p.Skip(STRUCT); err != nil {
+			done <- err
+			return
+		}
+		done <- p.ReadMessageEnd()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Unable to read message: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadMessageEnd() waited for data past the end of the message")
+	}
+}
@@ -20,12 +20,14 @@
 package thrift
 
 import (
-	"log"
+	"fmt"
+	"sync/atomic"
+	"time"
 )
 
 // Simple, non-concurrent server for testing.
 type TSimpleServer struct {
-	stopped bool
+	stopped int32
 
 	processorFactory       TProcessorFactory
 	serverTransport        TServerTransport
@@ -33,6 +35,12 @@ type TSimpleServer struct {
 	outputTransportFactory TTransportFactory
 	inputProtocolFactory   TProtocolFactory
 	outputProtocolFactory  TProtocolFactory
+	logger                 Logger
+	eventHandler           TServerEventHandler
+	authorizer             TAuthorizer
+	idleTimeout            time.Duration
+	messageTimeout         time.Duration
+	maxRequests            int
 }
 
 func NewTSimpleServer2(processor TProcessor, serverTransport TServerTransport) *TSimpleServer {
@@ -84,6 +92,7 @@ func NewTSimpleServerFactory6(processorFactory TProcessorFactory, serverTranspor
 		outputTransportFactory: outputTransportFactory,
 		inputProtocolFactory:   inputProtocolFactory,
 		outputProtocolFactory:  outputProtocolFactory,
+		logger:                 StdLogger(nil),
 	}
 }
 
@@ -111,21 +120,66 @@ func (p *TSimpleServer) OutputProtocolFactory() TProtocolFactory {
 	return p.outputProtocolFactory
 }
 
+// Sets the logger used for accept and processing errors and for the stack
+// of recovered handler panics.
+func (p *TSimpleServer) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = NopLogger
+	}
+	p.logger = logger
+}
+
+// Sets the handler notified of server and connection lifecycle events.
+func (p *TSimpleServer) SetServerEventHandler(handler TServerEventHandler) {
+	p.eventHandler = handler
+}
+
+// Sets the authorizer consulted for every new connection and every call.
+// Refused connections are closed before any message is read.
+func (p *TSimpleServer) SetAuthorizer(authorizer TAuthorizer) {
+	p.authorizer = authorizer
+}
+
+// Sets how long a connection may wait for the next message header before it
+// is closed. It replaces the timeout of the server socket between messages, for
+// connections accepted as a TSocket or TSSLSocket. Zero keeps that timeout.
+func (p *TSimpleServer) SetIdleTimeout(timeout time.Duration) {
+	p.idleTimeout = timeout
+}
+
+// Sets the time allowed for reading the rest of a message once its header
+// has been read. Connections failing to deliver the message in time are
+// closed.
+// Like SetIdleTimeout, it applies to TSocket and TSSLSocket connections.
+func (p *TSimpleServer) SetMessageTimeout(timeout time.Duration) {
+	p.messageTimeout = timeout
+}
+
+// Sets the number of messages served on a connection, after which it is
+// closed once the reply to the last one has been written. Zero, the
+// default, serves any number.
+func (p *TSimpleServer) SetMaxRequestsPerConnection(maxRequests int) {
+	p.maxRequests = maxRequests
+}
+
 func (p *TSimpleServer) Serve() error {
-	p.stopped = false
+	atomic.StoreInt32(&p.stopped, 0)
 	err := p.serverTransport.Listen()
 	if err != nil {
 		return err
 	}
-	for !p.stopped {
+	if p.eventHandler != nil {
+		p.eventHandler.PreServe()
+	}
+	for atomic.LoadInt32(&p.stopped) == 0 {
 		client, err := p.serverTransport.Accept()
 		if err != nil {
-			log.Println("Accept err: ", err)
+			p.logger(fmt.Sprint("Accept err: ", err))
 		}
 		if client != nil {
 			go func() {
 				if err := p.processRequest(client); err != nil {
-					log.Println("error processing request:", err)
+					p.logger(fmt.Sprint("error processing request: ", err))
 				}
 			}()
 		}
@@ -134,16 +188,34 @@ func (p *TSimpleServer) Serve() error {
 }
 
 func (p *TSimpleServer) Stop() error {
-	p.stopped = true
+	atomic.StoreInt32(&p.stopped, 1)
 	p.serverTransport.Interrupt()
 	return nil
 }
 
-func (p *TSimpleServer) processRequest(client TTransport) error {
-	processor := p.processorFactory.GetProcessor(client)
-	inputTransport := p.inputTransportFactory.GetTransport(client)
+// Serves all messages of one client connection. A panic raised while
+// processing a message is recovered, answered with an INTERNAL_ERROR reply
+// if the message expects one, and ends the connection.
+func (p *TSimpleServer) processRequest(client TTransport) (err error) {
+	ctx, err := newTConnectionContext(client)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	var input TTransport = client
+	var deadlines *tMessageDeadlineTransport
+	if p.idleTimeout > 0 || p.messageTimeout > 0 {
+		if deadlines = newTMessageDeadlineTransport(client, p.idleTimeout, p.messageTimeout); deadlines != nil {
+			input = deadlines
+		}
+	}
+	inputTransport := p.inputTransportFactory.GetTransport(input)
 	outputTransport := p.outputTransportFactory.GetTransport(client)
-	inputProtocol := p.inputProtocolFactory.GetProtocol(inputTransport)
+	protocol := p.inputProtocolFactory.GetProtocol(inputTransport)
+	if deadlines != nil {
+		protocol = deadlines.protocol(protocol)
+	}
+	inputProtocol := newTHeaderRecordingProtocol(protocol)
 	outputProtocol := p.outputProtocolFactory.GetProtocol(outputTransport)
 	if inputTransport != nil {
 		defer inputTransport.Close()
@@ -151,16 +223,50 @@ func (p *TSimpleServer) processRequest(client TTransport) error {
 	if outputTransport != nil {
 		defer outputTransport.Close()
 	}
-	for {
+	registerConnectionContext(ctx, client, inputTransport, outputTransport)
+	defer unregisterConnectionContext(client, inputTransport, outputTransport)
+	if p.eventHandler != nil {
+		defer p.eventHandler.DeleteContext(ctx, inputProtocol, outputProtocol)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverHandlerPanic(p.logger, r, inputProtocol.name, inputProtocol.typeId, inputProtocol.seqId, outputProtocol)
+		}
+	}()
+	if p.eventHandler != nil {
+		p.eventHandler.CreateContext(ctx, inputProtocol, outputProtocol)
+	}
+	if p.authorizer != nil {
+		if err := p.authorizer.AuthorizeConnection(ctx); err != nil {
+			return NewTTransportException(NOT_OPEN, "connection refused: "+err.Error())
+		}
+	}
+	processor := p.processorFactory.GetProcessor(client)
+	if p.authorizer != nil {
+		processor = WrapProcessor(processor, NewAuthorizationProcessorMiddleware(p.authorizer))
+	}
+	for requests := 1; ; requests++ {
+		if p.eventHandler != nil {
+			p.eventHandler.ProcessContext(ctx, client)
+		}
+		inputProtocol.reset()
+		if deadlines != nil {
+			deadlines.nextMessage()
+		}
 		ok, err := processor.Process(inputProtocol, outputProtocol)
 		if err, ok := err.(TTransportException); ok && err.TypeId() == END_OF_FILE{
 			return nil
+		} else if deadlines != nil && deadlines.idleExpired() {
+			return nil
 		} else if err != nil {
 			return err
 		}
 		if !ok || !inputProtocol.Transport().Peek() {
 			break
 		}
+		if p.maxRequests > 0 && requests >= p.maxRequests {
+			break
+		}
 	}
 	return nil
 }
@@ -25,9 +25,12 @@ import (
 )
 
 type TSocket struct {
-	conn    net.Conn
-	addr    net.Addr
-	timeout time.Duration
+	conn     net.Conn
+	addr     net.Addr
+	hostPort string
+	conf     TSocketConf
+	// Overrides the read timeout when set, see setReadDeadline.
+	readDeadline time.Time
 }
 
 // NewTSocket creates a net.Conn-backed TTransport, given a host and port
@@ -41,41 +44,58 @@ func NewTSocket(hostPort string) (*TSocket, error) {
 // NewTSocketTimeout creates a net.Conn-backed TTransport, given a host and port
 // it also accepts a timeout as a time.Duration
 func NewTSocketTimeout(hostPort string, timeout time.Duration) (*TSocket, error) {
-	//conn, err := net.DialTimeout(network, address, timeout)
-	addr, err := net.ResolveTCPAddr("tcp", hostPort)
+	conf := socketConfTimeout(timeout)
+	return NewTSocketConf(hostPort, &conf)
+}
+
+// NewTSocketConf creates a net.Conn-backed TTransport, given a host and port
+// and the configuration of its connections. A nil conf is the zero
+// TSocketConf.
+func NewTSocketConf(hostPort string, conf *TSocketConf) (*TSocket, error) {
+	if conf == nil {
+		conf = &TSocketConf{}
+	}
+	addr, err := resolveSocketAddr(hostPort, conf)
 	if err != nil {
 		return nil, err
 	}
-	return NewTSocketFromAddrTimeout(addr, timeout), nil
+	return &TSocket{addr: addr, hostPort: hostPort, conf: *conf}, nil
 }
 
 // Creates a TSocket from a net.Addr
 func NewTSocketFromAddrTimeout(addr net.Addr, timeout time.Duration) *TSocket {
-	return &TSocket{addr: addr, timeout: timeout}
+	return &TSocket{addr: addr, conf: socketConfTimeout(timeout)}
 }
 
 // Creates a TSocket from an existing net.Conn
 func NewTSocketFromConnTimeout(conn net.Conn, timeout time.Duration) *TSocket {
-	return &TSocket{conn: conn, addr: conn.RemoteAddr(), timeout: timeout}
+	return &TSocket{conn: conn, addr: conn.RemoteAddr(), conf: socketConfTimeout(timeout)}
 }
 
-// Sets the socket timeout
+// Sets the connect, read and write timeouts
 func (p *TSocket) SetTimeout(timeout time.Duration) error {
-	p.timeout = timeout
+	p.conf.ConnectTimeout = timeout
+	p.conf.ReadTimeout = timeout
+	p.conf.WriteTimeout = timeout
 	return nil
 }
 
+// Sets an absolute deadline for the following reads in place of the
+// socket timeout. The zero time restores the timeout.
+func (p *TSocket) setReadDeadline(t time.Time) {
+	p.readDeadline = t
+}
+
 func (p *TSocket) pushDeadline(read, write bool) {
-	var t time.Time
-	if p.timeout > 0 {
-		t = time.Now().Add(time.Duration(p.timeout))
-	}
-	if read && write {
-		p.conn.SetDeadline(t)
-	} else if read {
+	if read {
+		t := deadlineAfter(p.conf.ReadTimeout)
+		if !write && !p.readDeadline.IsZero() {
+			t = p.readDeadline
+		}
 		p.conn.SetReadDeadline(t)
-	} else if write {
-		p.conn.SetWriteDeadline(t)
+	}
+	if write {
+		p.conn.SetWriteDeadline(deadlineAfter(p.conf.WriteTimeout))
 	}
 }
 
@@ -84,6 +104,13 @@ func (p *TSocket) Open() error {
 	if p.IsOpen() {
 		return NewTTransportException(ALREADY_OPEN, "Socket already connected.")
 	}
+	if p.conf.ResolveOnOpen && p.hostPort != "" {
+		addr, err := net.ResolveTCPAddr("tcp", p.hostPort)
+		if err != nil {
+			return NewTTransportException(NOT_OPEN, err.Error())
+		}
+		p.addr = addr
+	}
 	if p.addr == nil {
 		return NewTTransportException(NOT_OPEN, "Cannot open nil address.")
 	}
@@ -93,8 +120,15 @@ func (p *TSocket) Open() error {
 	if len(p.addr.String()) == 0 {
 		return NewTTransportException(NOT_OPEN, "Cannot open bad address.")
 	}
-	var err error
-	if p.conn, err = net.DialTimeout(p.addr.Network(), p.addr.String(), p.timeout); err != nil {
+	dialer, err := p.conf.dialer()
+	if err != nil {
+		return NewTTransportException(NOT_OPEN, err.Error())
+	}
+	if p.conn, err = dialer.Dial(p.addr.Network(), p.addr.String()); err != nil {
+		return NewTTransportException(NOT_OPEN, err.Error())
+	}
+	if err = p.conf.apply(p.conn); err != nil {
+		p.Close()
 		return NewTTransportException(NOT_OPEN, err.Error())
 	}
 	return nil
@@ -0,0 +1,123 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The first file descriptor passed by systemd and by ReexecWithListeners.
+const listenFdsStart = 3
+
+// Environment variable carrying the number of listeners passed by
+// ReexecWithListeners.
+const inheritedListenersEnv = "THRIFT_LISTEN_FDS"
+
+// SystemdListeners returns the sockets passed to the process by systemd
+// socket activation (LISTEN_PID and LISTEN_FDS), in the order they are
+// declared in the socket unit. It returns no listeners if the process was
+// not socket activated. The environment variables are cleared so that
+// child processes do not pick the sockets up again.
+func SystemdListeners() ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	return listenersFromEnv("LISTEN_FDS")
+}
+
+// InheritedListeners returns the listeners passed by a parent process with
+// ReexecWithListeners, falling back to SystemdListeners.
+func InheritedListeners() ([]net.Listener, error) {
+	if os.Getenv(inheritedListenersEnv) == "" {
+		return SystemdListeners()
+	}
+	defer os.Unsetenv(inheritedListenersEnv)
+	return listenersFromEnv(inheritedListenersEnv)
+}
+
+func listenersFromEnv(name string) ([]net.Listener, error) {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid %s: %q", name, os.Getenv(name))
+	}
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFdsStart; fd < listenFdsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "listener"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("fd %d is not a listening socket: %s", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// ReexecWithListeners starts a new instance of the running program with the
+// same arguments and environment, handing it the given listeners so that a
+// restart does not close the listening ports. The new process finds them,
+// in the same order, with InheritedListeners. The caller keeps its own
+// listeners open and should stop accepting and exit once the new process is
+// ready.
+func ReexecWithListeners(listeners ...net.Listener) (*os.Process, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return startWithListeners(path, os.Args, os.Environ(), listeners)
+}
+
+func startWithListeners(path string, argv []string, env []string, listeners []net.Listener) (*os.Process, error) {
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	for _, l := range listeners {
+		fl, ok := l.(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			return nil, fmt.Errorf("listener of type %T cannot be inherited", l)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	childEnv := make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, inheritedListenersEnv+"=") && !strings.HasPrefix(kv, "LISTEN_PID=") &&
+			!strings.HasPrefix(kv, "LISTEN_FDS=") && !strings.HasPrefix(kv, "LISTEN_FDNAMES=") {
+			childEnv = append(childEnv, kv)
+		}
+	}
+	childEnv = append(childEnv, inheritedListenersEnv+"="+strconv.Itoa(len(listeners)))
+	return os.StartProcess(path, argv, &os.ProcAttr{Env: childEnv, Files: files})
+}
@@ -0,0 +1,182 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestServerSocketFromListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	server := NewTServerSocketFromListener(l, 0)
+	defer server.Close()
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen() failed: %s", err)
+	}
+	if server.Addr().String() != l.Addr().String() {
+		t.Fatalf("Expected address %s but got %s", l.Addr(), server.Addr())
+	}
+	go func() {
+		if conn, err := net.Dial("tcp", l.Addr().String()); err == nil {
+			conn.Write([]byte("x"))
+			conn.Close()
+		}
+	}()
+	client, err := server.Accept()
+	if err != nil {
+		t.Fatalf("Accept() failed: %s", err)
+	}
+	defer client.Close()
+	buf := make([]byte, 1)
+	if _, err := client.Read(buf); err != nil || buf[0] != 'x' {
+		t.Fatalf("Unexpected read %q: %v", buf, err)
+	}
+}
+
+func TestSSLServerSocketFromListener(t *testing.T) {
+	pki := newTestPKI(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	server := NewTSSLServerSocketFromListener(l, &tls.Config{Certificates: []tls.Certificate{pki.issue(t, 2, "server")}}, 0)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen() failed: %s", err)
+	}
+	defer server.Close()
+	go func() {
+		if client, err := server.Accept(); err == nil {
+			client.(*TSSLSocket).Handshake()
+			client.Close()
+		}
+	}()
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{RootCAs: pki.pool, ServerName: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("TLS handshake through the wrapped listener failed: %s", err)
+	}
+	conn.Close()
+}
+
+// Runs in the process started by TestReexecWithListeners: accepts one
+// connection on the inherited listener and greets it.
+func TestInheritedListenerHelper(t *testing.T) {
+	if os.Getenv("THRIFT_TEST_INHERIT_HELPER") == "" {
+		return
+	}
+	listeners, err := InheritedListeners()
+	if err != nil || len(listeners) != 1 {
+		t.Fatalf("InheritedListeners() returned %v, %v", listeners, err)
+	}
+	server := NewTServerSocketFromListener(listeners[0], 0)
+	defer server.Close()
+	client, err := server.Accept()
+	if err != nil {
+		t.Fatalf("Accept() failed: %s", err)
+	}
+	client.Write([]byte("hello from child\n"))
+	client.Close()
+}
+
+func TestReexecWithListeners(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Listeners cannot be inherited on windows")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	path, err := os.Executable()
+	if err != nil {
+		t.Skipf("Cannot locate test binary: %s", err)
+	}
+	env := append(os.Environ(), "THRIFT_TEST_INHERIT_HELPER=1")
+	proc, err := startWithListeners(path, []string{path, "-test.run=^TestInheritedListenerHelper$"}, env, []net.Listener{l})
+	if err != nil {
+		t.Fatalf("startWithListeners() failed: %s", err)
+	}
+	// Only the child may accept from now on.
+	addr := l.Addr().String()
+	l.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Unable to connect to inherited listener: %s", err)
+	}
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "hello from child\n" {
+		t.Fatalf("Unexpected greeting %q: %v", line, err)
+	}
+	state, err := proc.Wait()
+	if err != nil || !state.Success() {
+		t.Fatalf("Child process failed: %v %v", state, err)
+	}
+}
+
+// Stopping a server interrupts and closes its server transport while Serve
+// may still be accepting on it.
+func testServerTransportInterrupt(t *testing.T, server TServerTransport) {
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen() failed: %s", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		for {
+			client, err := server.Accept()
+			if err != nil {
+				done <- err
+				return
+			}
+			client.Close()
+		}
+	}()
+	server.Interrupt()
+	server.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Accept() did not return after Interrupt and Close")
+	}
+}
+
+func TestServerSocketInterruptWhileAccepting(t *testing.T) {
+	server, err := NewTServerSocket("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewTServerSocket() failed: %s", err)
+	}
+	testServerTransportInterrupt(t, server)
+}
+
+func TestSSLServerSocketInterruptWhileAccepting(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	testServerTransportInterrupt(t, NewTSSLServerSocketFromListener(l, &tls.Config{}, 0))
+}
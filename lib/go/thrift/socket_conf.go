@@ -0,0 +1,85 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// TSocketConf configures the connections of a TSocket or TSSLSocket. The
+// zero value dials without timeouts and leaves the socket options to Go's
+// defaults, which enable keepalive and TCP_NODELAY.
+type TSocketConf struct {
+	// Limits dialing, including the TLS handshake of a TSSLSocket.
+	ConnectTimeout time.Duration
+	// Limit each read and each write.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// The period of TCP keepalive probes. Negative disables keepalive and
+	// zero keeps the default.
+	KeepAlive time.Duration
+	// Sets or clears TCP_NODELAY, if not nil.
+	NoDelay *bool
+	// The local address to bind before connecting, e.g. "10.0.0.1:0".
+	LocalAddr string
+	// Resolve the host name on every Open instead of once at creation, so
+	// that a reconnecting client follows DNS changes.
+	ResolveOnOpen bool
+}
+
+// The configuration equivalent to a single timeout for everything.
+func socketConfTimeout(timeout time.Duration) TSocketConf {
+	return TSocketConf{ConnectTimeout: timeout, ReadTimeout: timeout, WriteTimeout: timeout}
+}
+
+func (c *TSocketConf) dialer() (*net.Dialer, error) {
+	d := &net.Dialer{Timeout: c.ConnectTimeout, KeepAlive: c.KeepAlive}
+	if c.LocalAddr != "" {
+		addr, err := net.ResolveTCPAddr("tcp", c.LocalAddr)
+		if err != nil {
+			return nil, err
+		}
+		d.LocalAddr = addr
+	}
+	return d, nil
+}
+
+// Applies the options that can only be set on an established connection.
+func (c *TSocketConf) apply(conn net.Conn) error {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok && c.NoDelay != nil {
+		return tcpConn.SetNoDelay(*c.NoDelay)
+	}
+	return nil
+}
+
+// Resolves hostPort now unless conf asks for it to be resolved on Open.
+// In that case only its syntax is checked and the returned address is nil.
+func resolveSocketAddr(hostPort string, conf *TSocketConf) (net.Addr, error) {
+	if conf.ResolveOnOpen {
+		_, _, err := net.SplitHostPort(hostPort)
+		return nil, err
+	}
+	return net.ResolveTCPAddr("tcp", hostPort)
+}
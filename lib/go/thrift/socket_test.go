@@ -0,0 +1,88 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSocketConf(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	socket, err := NewTSocketConf(net.JoinHostPort("localhost", port), &TSocketConf{
+		ConnectTimeout: time.Second,
+		ReadTimeout:    50 * time.Millisecond,
+		KeepAlive:      -1,
+		NoDelay:        BoolPtr(false),
+		LocalAddr:      "127.0.0.1:0",
+		ResolveOnOpen:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if socket.addr != nil {
+		t.Fatalf("Expected the address to be resolved on Open, got %s", socket.addr)
+	}
+	if err := socket.Open(); err != nil {
+		t.Fatalf("Unable to open socket: %s", err)
+	}
+	defer socket.Close()
+	conn := <-accepted
+	defer conn.Close()
+	if conn.RemoteAddr().String() != socket.Conn().LocalAddr().String() {
+		t.Fatalf("Unexpected local address %s", socket.Conn().LocalAddr())
+	}
+
+	if _, err := socket.Write([]byte("ping")); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	_, err = socket.Read(make([]byte, 1))
+	if e, ok := err.(TTransportException); !ok || e.TypeId() != TIMED_OUT {
+		t.Fatalf("Expected TIMED_OUT, got %v", err)
+	}
+}
+
+func TestSocketConfErrors(t *testing.T) {
+	if _, err := NewTSocketConf("no-port", &TSocketConf{ResolveOnOpen: true}); err == nil {
+		t.Fatal("Expected an error for an address without port")
+	}
+	socket, err := NewTSocketConf("127.0.0.1:1", &TSocketConf{LocalAddr: "not an address"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := socket.Open(); err == nil {
+		t.Fatal("Expected an error for an invalid local address")
+	} else if e, ok := err.(TTransportException); !ok || e.TypeId() != NOT_OPEN {
+		t.Fatalf("Expected NOT_OPEN, got %v", err)
+	}
+}
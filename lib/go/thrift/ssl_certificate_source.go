@@ -0,0 +1,257 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// TCertificateSource supplies the certificate and CA bundle used for TLS
+// handshakes. The values may change over time; TSSLServerSocket and
+// TSSLSocket ask for them on every new handshake.
+type TCertificateSource interface {
+	// The certificate to present to the peer.
+	Certificate() (*tls.Certificate, error)
+	// The CAs used to verify the peer, or nil to keep those of the
+	// tls.Config.
+	CertPool() *x509.CertPool
+}
+
+// TFileCertificateSource is a TCertificateSource backed by PEM files. The
+// files are reloaded on demand by Reload, and automatically once Watch has
+// been called and a file changes on disk. A failed reload keeps the
+// previously loaded certificates in use.
+type TFileCertificateSource struct {
+	certFile, keyFile, caFile string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	versions []fileVersion
+	onReload func(err error)
+	stop     chan struct{}
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewTFileCertificateSource loads the certificate and key from certFile and
+// keyFile, and the CA bundle from caFile unless it is empty.
+func NewTFileCertificateSource(certFile, keyFile, caFile string) (*TFileCertificateSource, error) {
+	s := &TFileCertificateSource{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Sets a function called after every reload attempt, with nil on success or
+// the error that caused the old certificates to be kept.
+func (s *TFileCertificateSource) SetReloadHandler(onReload func(err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onReload = onReload
+}
+
+func (s *TFileCertificateSource) files() []string {
+	if s.caFile == "" {
+		return []string{s.certFile, s.keyFile}
+	}
+	return []string{s.certFile, s.keyFile, s.caFile}
+}
+
+func (s *TFileCertificateSource) stat() ([]fileVersion, error) {
+	var versions []fileVersion
+	for _, name := range s.files() {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, fileVersion{fi.ModTime(), fi.Size()})
+	}
+	return versions, nil
+}
+
+func (s *TFileCertificateSource) load() error {
+	versions, err := s.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if s.caFile != "" {
+		pem, err := ioutil.ReadFile(s.caFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + s.caFile)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cert, s.pool, s.versions = &cert, pool, versions
+	return nil
+}
+
+// Reload reads the files again. On error the previous certificates stay in
+// use and the error is also passed to the reload handler.
+func (s *TFileCertificateSource) Reload() error {
+	err := s.load()
+	s.mu.RLock()
+	onReload := s.onReload
+	s.mu.RUnlock()
+	if onReload != nil {
+		onReload(err)
+	}
+	return err
+}
+
+// Reports whether any of the files differs from the loaded version.
+func (s *TFileCertificateSource) changed() bool {
+	versions, err := s.stat()
+	if err != nil {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range versions {
+		if !versions[i].modTime.Equal(s.versions[i].modTime) || versions[i].size != s.versions[i].size {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch checks the files every interval and reloads them when they
+// change, until Close is called. Files that cannot be read are retried at
+// the next check.
+func (s *TFileCertificateSource) Watch(interval time.Duration) {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	s.stop = stop
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastErr error
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if !s.changed() {
+					continue
+				}
+				// Report a persistent failure once rather than on every tick.
+				if err := s.load(); err == nil || lastErr == nil || err.Error() != lastErr.Error() {
+					s.mu.RLock()
+					onReload := s.onReload
+					s.mu.RUnlock()
+					if onReload != nil {
+						onReload(err)
+					}
+					lastErr = err
+				}
+			}
+		}
+	}()
+}
+
+// Stops watching the files.
+func (s *TFileCertificateSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	return nil
+}
+
+func (s *TFileCertificateSource) Certificate() (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cert, nil
+}
+
+func (s *TFileCertificateSource) CertPool() *x509.CertPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pool
+}
+
+// Returns a server side tls.Config based on cfg that takes its certificate
+// and client CAs from source on every handshake.
+func serverConfigFromSource(cfg *tls.Config, source TCertificateSource) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	c := cfg.Clone()
+	c.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return source.Certificate()
+	}
+	c.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, err := source.Certificate()
+		if err != nil {
+			return nil, err
+		}
+		current := cfg.Clone()
+		current.Certificates = []tls.Certificate{*cert}
+		if pool := source.CertPool(); pool != nil {
+			current.ClientCAs = pool
+		}
+		return current, nil
+	}
+	return c
+}
+
+// Returns a client side tls.Config based on cfg that presents the
+// certificate of source and verifies servers with its CAs.
+func clientConfigFromSource(cfg *tls.Config, source TCertificateSource) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	c := cfg.Clone()
+	c.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return source.Certificate()
+	}
+	if pool := source.CertPool(); pool != nil {
+		c.RootCAs = pool
+	}
+	return c
+}
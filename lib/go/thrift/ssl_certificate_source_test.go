@@ -0,0 +1,197 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCertificate(t *testing.T, dir string, cert tls.Certificate) (certFile, keyFile string) {
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("Unable to marshal key: %s", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatalf("Unable to write %s: %s", certFile, err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("Unable to write %s: %s", keyFile, err)
+	}
+	return
+}
+
+func sourceCommonName(t *testing.T, source TCertificateSource) string {
+	cert, err := source.Certificate()
+	if err != nil {
+		t.Fatalf("Certificate() failed: %s", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Unable to parse certificate: %s", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestFileCertificateSourceReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thrift-certs")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	pki := newTestPKI(t)
+	certFile, keyFile := writeTestCertificate(t, dir, pki.issue(t, 2, "first"))
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pki.caCert.Raw}), 0600)
+
+	source, err := NewTFileCertificateSource(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("NewTFileCertificateSource() failed: %s", err)
+	}
+	if source.CertPool() == nil {
+		t.Fatalf("Expected a CA pool")
+	}
+	var events []error
+	source.SetReloadHandler(func(err error) { events = append(events, err) })
+
+	writeTestCertificate(t, dir, pki.issue(t, 3, "second"))
+	if err := source.Reload(); err != nil {
+		t.Fatalf("Reload() failed: %s", err)
+	}
+	if cn := sourceCommonName(t, source); cn != "second" {
+		t.Fatalf("Expected reloaded certificate but got %q", cn)
+	}
+
+	ioutil.WriteFile(keyFile, []byte("garbage"), 0600)
+	if err := source.Reload(); err == nil {
+		t.Fatalf("Expected Reload() to fail on a broken key")
+	}
+	if cn := sourceCommonName(t, source); cn != "second" {
+		t.Fatalf("Expected the previous certificate to be kept but got %q", cn)
+	}
+	if len(events) != 2 || events[0] != nil || events[1] == nil {
+		t.Fatalf("Unexpected reload events %v", events)
+	}
+}
+
+func TestFileCertificateSourceWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thrift-certs")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	pki := newTestPKI(t)
+	certFile, keyFile := writeTestCertificate(t, dir, pki.issue(t, 2, "first"))
+	source, err := NewTFileCertificateSource(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("NewTFileCertificateSource() failed: %s", err)
+	}
+	reloaded := make(chan error, 16)
+	source.SetReloadHandler(func(err error) {
+		select {
+		case reloaded <- err:
+		default:
+		}
+	})
+	source.Watch(10 * time.Millisecond)
+	defer source.Close()
+
+	writeTestCertificate(t, dir, pki.issue(t, 3, "second"))
+	// Make the change visible even on file systems with coarse timestamps.
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	// The watcher may catch the certificate and key half written, so wait
+	// for the first successful reload.
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case err := <-reloaded:
+			done = err == nil
+		case <-timeout:
+			t.Fatalf("Certificate change was not detected")
+		}
+	}
+	if cn := sourceCommonName(t, source); cn != "second" {
+		t.Fatalf("Expected reloaded certificate but got %q", cn)
+	}
+}
+
+func TestSSLServerSocketCertificateSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thrift-certs")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	pki := newTestPKI(t)
+	certFile, keyFile := writeTestCertificate(t, dir, pki.issue(t, 2, "first"))
+	source, err := NewTFileCertificateSource(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("NewTFileCertificateSource() failed: %s", err)
+	}
+	server, err := NewTSSLServerSocket("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatalf("NewTSSLServerSocket() failed: %s", err)
+	}
+	server.SetCertificateSource(source)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen() failed: %s", err)
+	}
+	defer server.Close()
+	go func() {
+		for {
+			client, err := server.Accept()
+			if err != nil {
+				return
+			}
+			client.(*TSSLSocket).Handshake()
+			client.Close()
+		}
+	}()
+
+	serverName := func() string {
+		conn, err := tls.Dial("tcp", server.listener.Addr().String(), &tls.Config{RootCAs: pki.pool, ServerName: "127.0.0.1"})
+		if err != nil {
+			t.Fatalf("Dial failed: %s", err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if cn := serverName(); cn != "first" {
+		t.Fatalf("Expected certificate first but got %q", cn)
+	}
+	writeTestCertificate(t, dir, pki.issue(t, 3, "second"))
+	if err := source.Reload(); err != nil {
+		t.Fatalf("Reload() failed: %s", err)
+	}
+	if cn := serverName(); cn != "second" {
+		t.Fatalf("Expected certificate second but got %q", cn)
+	}
+}
@@ -21,6 +21,7 @@ package thrift
 
 import (
 	"net"
+	"sync"
 	"time"
 	"crypto/tls"
 )
@@ -31,6 +32,10 @@ type TSSLServerSocket struct {
 	clientTimeout time.Duration
 	interrupted   bool
 	cfg           *tls.Config
+	base          net.Listener
+	// Guards listener and interrupted, which Stop and Close change while
+	// Serve is accepting.
+	mu sync.RWMutex
 }
 
 func NewTSSLServerSocket(listenAddr string, cfg *tls.Config) (*TSSLServerSocket, error) {
@@ -45,11 +50,27 @@ func NewTSSLServerSocketTimeout(listenAddr string, cfg *tls.Config, clientTimeou
 	return &TSSLServerSocket{addr: addr, clientTimeout: clientTimeout, cfg: cfg}, nil
 }
 
+// Makes new handshakes use the certificate and client CAs of source, so
+// that they can be rotated without restarting the server. It must be called
+// before Listen.
+func (p *TSSLServerSocket) SetCertificateSource(source TCertificateSource) {
+	p.cfg = serverConfigFromSource(p.cfg, source)
+}
+
+// Creates a TSSLServerSocket accepting TLS connections from an existing
+// listener, such as one inherited through socket activation. The server
+// socket takes ownership of l and closes it on Close.
+func NewTSSLServerSocketFromListener(l net.Listener, cfg *tls.Config, clientTimeout time.Duration) *TSSLServerSocket {
+	return &TSSLServerSocket{base: l, addr: l.Addr(), clientTimeout: clientTimeout, cfg: cfg}
+}
+
 func (p *TSSLServerSocket) Listen() error {
-	if p.IsListening() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listener != nil {
 		return nil
 	}
-	l, err := tls.Listen(p.addr.Network(), p.addr.String(), p.cfg)
+	l, err := p.listen()
 	if err != nil {
 		return err
 	}
@@ -57,14 +78,24 @@ func (p *TSSLServerSocket) Listen() error {
 	return nil
 }
 
+func (p *TSSLServerSocket) listen() (net.Listener, error) {
+	if p.base != nil {
+		return tls.NewListener(p.base, p.cfg), nil
+	}
+	return tls.Listen(p.addr.Network(), p.addr.String(), p.cfg)
+}
+
 func (p *TSSLServerSocket) Accept() (TTransport, error) {
-	if p.interrupted {
+	p.mu.RLock()
+	interrupted, listener := p.interrupted, p.listener
+	p.mu.RUnlock()
+	if interrupted {
 		return nil, errTransportInterrupted
 	}
-	if p.listener == nil {
+	if listener == nil {
 		return nil, NewTTransportException(NOT_OPEN, "No underlying server socket")
 	}
-	conn, err := p.listener.Accept()
+	conn, err := listener.Accept()
 	if err != nil {
 		return nil, NewTTransportExceptionFromError(err)
 	}
@@ -73,15 +104,19 @@ func (p *TSSLServerSocket) Accept() (TTransport, error) {
 
 // Checks whether the socket is listening.
 func (p *TSSLServerSocket) IsListening() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return p.listener != nil
 }
 
 // Connects the socket, creating a new socket object if necessary.
 func (p *TSSLServerSocket) Open() error {
-	if p.IsListening() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listener != nil {
 		return NewTTransportException(ALREADY_OPEN, "Server socket already open")
 	}
-	if l, err := tls.Listen(p.addr.Network(), p.addr.String(), p.cfg); err != nil {
+	if l, err := p.listen(); err != nil {
 		return err
 	} else {
 		p.listener = l
@@ -94,16 +129,20 @@ func (p *TSSLServerSocket) Addr() net.Addr {
 }
 
 func (p *TSSLServerSocket) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	defer func() {
 		p.listener = nil
 	}()
-	if p.IsListening() {
+	if p.listener != nil {
 		return p.listener.Close()
 	}
 	return nil
 }
 
 func (p *TSSLServerSocket) Interrupt() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.interrupted = true
 	return nil
 }
@@ -26,10 +26,14 @@ import (
 )
 
 type TSSLSocket struct {
-	conn    net.Conn
-	addr    net.Addr
-	timeout time.Duration
-	cfg     *tls.Config
+	conn     net.Conn
+	addr     net.Addr
+	hostPort string
+	conf     TSocketConf
+	cfg      *tls.Config
+	source   TCertificateSource
+	// Overrides the read timeout when set, see setReadDeadline.
+	readDeadline time.Time
 }
 
 // NewTSSLSocket creates a net.Conn-backed TTransport, given a host and port and tls Configuration
@@ -43,41 +47,64 @@ func NewTSSLSocket(hostPort string, cfg *tls.Config) (*TSSLSocket, error) {
 // NewTSSLSocketTimeout creates a net.Conn-backed TTransport, given a host and port
 // it also accepts a tls Configuration and a timeout as a time.Duration
 func NewTSSLSocketTimeout(hostPort string, cfg *tls.Config, timeout time.Duration) (*TSSLSocket, error) {
-	//conn, err := net.DialTimeout(network, address, timeout)
-	addr, err := net.ResolveTCPAddr("tcp", hostPort)
+	conf := socketConfTimeout(timeout)
+	return NewTSSLSocketConf(hostPort, cfg, &conf)
+}
+
+// NewTSSLSocketConf creates a net.Conn-backed TTransport, given a host and
+// port, a tls Configuration and the configuration of its connections. A nil
+// conf is the zero TSocketConf.
+func NewTSSLSocketConf(hostPort string, cfg *tls.Config, conf *TSocketConf) (*TSSLSocket, error) {
+	if conf == nil {
+		conf = &TSocketConf{}
+	}
+	addr, err := resolveSocketAddr(hostPort, conf)
 	if err != nil {
 		return nil, err
 	}
-	return NewTSSLSocketFromAddrTimeout(addr, cfg, timeout), nil
+	return &TSSLSocket{addr: addr, hostPort: hostPort, conf: *conf, cfg: cfg}, nil
 }
 
 // Creates a TSSLSocket from a net.Addr
 func NewTSSLSocketFromAddrTimeout(addr net.Addr, cfg *tls.Config, timeout time.Duration) *TSSLSocket {
-	return &TSSLSocket{addr: addr, timeout: timeout, cfg: cfg}
+	return &TSSLSocket{addr: addr, conf: socketConfTimeout(timeout), cfg: cfg}
 }
 
 // Creates a TSSLSocket from an existing net.Conn
 func NewTSSLSocketFromConnTimeout(conn net.Conn, cfg *tls.Config, timeout time.Duration) *TSSLSocket {
-	return &TSSLSocket{conn: conn, addr: conn.RemoteAddr(), timeout: timeout, cfg: cfg}
+	return &TSSLSocket{conn: conn, addr: conn.RemoteAddr(), conf: socketConfTimeout(timeout), cfg: cfg}
 }
 
-// Sets the socket timeout
+// Makes Open present the client certificate of source and verify the
+// server with its CAs, both read afresh for every connection.
+func (p *TSSLSocket) SetCertificateSource(source TCertificateSource) {
+	p.source = source
+}
+
+// Sets the connect, read and write timeouts
 func (p *TSSLSocket) SetTimeout(timeout time.Duration) error {
-	p.timeout = timeout
+	p.conf.ConnectTimeout = timeout
+	p.conf.ReadTimeout = timeout
+	p.conf.WriteTimeout = timeout
 	return nil
 }
 
+// Sets an absolute deadline for the following reads in place of the
+// socket timeout. The zero time restores the timeout.
+func (p *TSSLSocket) setReadDeadline(t time.Time) {
+	p.readDeadline = t
+}
+
 func (p *TSSLSocket) pushDeadline(read, write bool) {
-	var t time.Time
-	if p.timeout > 0 {
-		t = time.Now().Add(time.Duration(p.timeout))
-	}
-	if read && write {
-		p.conn.SetDeadline(t)
-	} else if read {
+	if read {
+		t := deadlineAfter(p.conf.ReadTimeout)
+		if !write && !p.readDeadline.IsZero() {
+			t = p.readDeadline
+		}
 		p.conn.SetReadDeadline(t)
-	} else if write {
-		p.conn.SetWriteDeadline(t)
+	}
+	if write {
+		p.conn.SetWriteDeadline(deadlineAfter(p.conf.WriteTimeout))
 	}
 }
 
@@ -86,6 +113,13 @@ func (p *TSSLSocket) Open() error {
 	if p.IsOpen() {
 		return NewTTransportException(ALREADY_OPEN, "Socket already connected.")
 	}
+	if p.conf.ResolveOnOpen && p.hostPort != "" {
+		addr, err := net.ResolveTCPAddr("tcp", p.hostPort)
+		if err != nil {
+			return NewTTransportException(NOT_OPEN, err.Error())
+		}
+		p.addr = addr
+	}
 	if p.addr == nil {
 		return NewTTransportException(NOT_OPEN, "Cannot open nil address.")
 	}
@@ -95,13 +129,44 @@ func (p *TSSLSocket) Open() error {
 	if len(p.addr.String()) == 0 {
 		return NewTTransportException(NOT_OPEN, "Cannot open bad address.")
 	}
-	var err error
-	if p.conn, err = tls.Dial(p.addr.Network(), p.addr.String(), p.cfg); err != nil {
+	cfg := p.cfg
+	if p.source != nil {
+		cfg = clientConfigFromSource(cfg, p.source)
+	}
+	dialer, err := p.conf.dialer()
+	if err != nil {
+		return NewTTransportException(NOT_OPEN, err.Error())
+	}
+	if p.conn, err = tls.DialWithDialer(dialer, p.addr.Network(), p.addr.String(), cfg); err != nil {
+		return NewTTransportException(NOT_OPEN, err.Error())
+	}
+	if err = p.conf.apply(p.conn); err != nil {
+		p.Close()
 		return NewTTransportException(NOT_OPEN, err.Error())
 	}
 	return nil
 }
 
+// Runs the TLS handshake unless it has already completed, honouring the
+// socket timeout.
+func (p *TSSLSocket) Handshake() error {
+	c, ok := p.conn.(*tls.Conn)
+	if !ok {
+		return NewTTransportException(NOT_OPEN, "Connection not open")
+	}
+	p.pushDeadline(true, true)
+	return NewTTransportExceptionFromError(c.Handshake())
+}
+
+// Returns the state of the TLS connection. It is empty until the handshake
+// has completed.
+func (p *TSSLSocket) ConnectionState() tls.ConnectionState {
+	if c, ok := p.conn.(*tls.Conn); ok {
+		return c.ConnectionState()
+	}
+	return tls.ConnectionState{}
+}
+
 // Retreive the underlying net.Conn
 func (p *TSSLSocket) Conn() net.Conn {
 	return p.conn
@@ -0,0 +1,243 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// The counters of a TStatsTransport, of a TStatsTransportFactory or of all
+// of them. Latencies are the total time spent in Read, and in Write and
+// Flush.
+type TTransportStats struct {
+	BytesRead    int64
+	BytesWritten int64
+	Reads        int64
+	Writes       int64
+	Flushes      int64
+	ReadLatency  time.Duration
+	WriteLatency time.Duration
+	// Errors by TTransportException type id, e.g. Errors[TIMED_OUT]. Errors
+	// of other types are counted as UNKNOWN_TRANSPORT_EXCEPTION.
+	//
+	// Errors[END_OF_FILE] includes the peer closing the connection between
+	// messages, so every server connection ended by its client adds one. A
+	// transport cannot tell that from a connection lost before a reply, and
+	// a server's input and output are wrapped separately, so those are
+	// counted alike; compare it with the number of connections rather than
+	// treating it as a failure rate.
+	Errors [END_OF_FILE + 1]int64
+}
+
+// Returns the mean latency of a read, or 0 if there were none.
+func (s TTransportStats) MeanReadLatency() time.Duration {
+	if s.Reads == 0 {
+		return 0
+	}
+	return s.ReadLatency / time.Duration(s.Reads)
+}
+
+// Returns the mean latency of a write or flush, or 0 if there were none.
+func (s TTransportStats) MeanWriteLatency() time.Duration {
+	if s.Writes+s.Flushes == 0 {
+		return 0
+	}
+	return s.WriteLatency / time.Duration(s.Writes+s.Flushes)
+}
+
+type tTransportCounters struct {
+	bytesRead    int64
+	bytesWritten int64
+	reads        int64
+	writes       int64
+	flushes      int64
+	readNanos    int64
+	writeNanos   int64
+	errors       [END_OF_FILE + 1]int64
+}
+
+func (c *tTransportCounters) stats() TTransportStats {
+	s := TTransportStats{
+		BytesRead:    atomic.LoadInt64(&c.bytesRead),
+		BytesWritten: atomic.LoadInt64(&c.bytesWritten),
+		Reads:        atomic.LoadInt64(&c.reads),
+		Writes:       atomic.LoadInt64(&c.writes),
+		Flushes:      atomic.LoadInt64(&c.flushes),
+		ReadLatency:  time.Duration(atomic.LoadInt64(&c.readNanos)),
+		WriteLatency: time.Duration(atomic.LoadInt64(&c.writeNanos)),
+	}
+	for i := range c.errors {
+		s.Errors[i] = atomic.LoadInt64(&c.errors[i])
+	}
+	return s
+}
+
+func (c *tTransportCounters) read(n int, latency time.Duration) {
+	atomic.AddInt64(&c.reads, 1)
+	atomic.AddInt64(&c.bytesRead, int64(n))
+	atomic.AddInt64(&c.readNanos, int64(latency))
+}
+
+func (c *tTransportCounters) write(n int, latency time.Duration) {
+	atomic.AddInt64(&c.writes, 1)
+	atomic.AddInt64(&c.bytesWritten, int64(n))
+	atomic.AddInt64(&c.writeNanos, int64(latency))
+}
+
+func (c *tTransportCounters) flush(latency time.Duration) {
+	atomic.AddInt64(&c.flushes, 1)
+	atomic.AddInt64(&c.writeNanos, int64(latency))
+}
+
+func (c *tTransportCounters) fail(err error) {
+	typeId := NewTTransportExceptionFromError(err).TypeId()
+	if typeId < 0 || typeId >= len(c.errors) {
+		typeId = UNKNOWN_TRANSPORT_EXCEPTION
+	}
+	atomic.AddInt64(&c.errors[typeId], 1)
+}
+
+// Counts the traffic of all TStatsTransports.
+var globalTransportCounters tTransportCounters
+
+// Returns the counters of all TStatsTransports of the process.
+func GlobalTransportStats() TTransportStats {
+	return globalTransportCounters.stats()
+}
+
+// TStatsTransport counts the bytes, calls, latencies and errors of the
+// transport it wraps. The counters are also added to those of the factory
+// that created it, if any, and to GlobalTransportStats. Reading them is
+// safe while the transport is in use.
+type TStatsTransport struct {
+	TTransport
+	counters []*tTransportCounters
+	own      tTransportCounters
+}
+
+func NewTStatsTransport(trans TTransport) *TStatsTransport {
+	return newTStatsTransport(trans, nil)
+}
+
+func newTStatsTransport(trans TTransport, factory *tTransportCounters) *TStatsTransport {
+	p := &TStatsTransport{TTransport: trans}
+	p.counters = []*tTransportCounters{&p.own, &globalTransportCounters}
+	if factory != nil {
+		p.counters = append(p.counters, factory)
+	}
+	return p
+}
+
+// Returns the counters of this transport.
+func (p *TStatsTransport) Stats() TTransportStats {
+	return p.own.stats()
+}
+
+// Returns the wrapped transport.
+func (p *TStatsTransport) Transport() TTransport {
+	return p.TTransport
+}
+
+func (p *TStatsTransport) Open() error {
+	return p.record(p.TTransport.Open())
+}
+
+func (p *TStatsTransport) Close() error {
+	return p.record(p.TTransport.Close())
+}
+
+func (p *TStatsTransport) Read(buf []byte) (int, error) {
+	start := time.Now()
+	n, err := p.TTransport.Read(buf)
+	latency := time.Since(start)
+	for _, c := range p.counters {
+		c.read(n, latency)
+	}
+	return n, p.record(err)
+}
+
+func (p *TStatsTransport) Write(buf []byte) (int, error) {
+	start := time.Now()
+	n, err := p.TTransport.Write(buf)
+	latency := time.Since(start)
+	for _, c := range p.counters {
+		c.write(n, latency)
+	}
+	return n, p.record(err)
+}
+
+func (p *TStatsTransport) Flush() error {
+	start := time.Now()
+	err := p.TTransport.Flush()
+	latency := time.Since(start)
+	for _, c := range p.counters {
+		c.flush(latency)
+	}
+	return p.record(err)
+}
+
+func (p *TStatsTransport) remainingBytes() int {
+	return remainingBytes(p.TTransport)
+}
+
+// Counts err, if not nil, and returns it. END_OF_FILE is counted too, see
+// TTransportStats.Errors.
+func (p *TStatsTransport) record(err error) error {
+	if err != nil {
+		for _, c := range p.counters {
+			c.fail(err)
+		}
+	}
+	return err
+}
+
+// TStatsTransportFactory wraps the transports it is given in a
+// TStatsTransport before passing them to the factory it wraps, so that the
+// bytes are counted as they go over the wire, including any framing. It
+// serves both sides of a TSimpleServer, e.g.
+//
+//	stats := thrift.NewTStatsTransportFactory(thrift.NewTFramedTransportFactory(thrift.NewTTransportFactory()))
+//	server := thrift.NewTSimpleServer4(processor, serverTransport, stats, protocolFactory)
+//
+// and, on the client, stats.GetTransport(socket) instead of wrapping the
+// socket directly.
+type TStatsTransportFactory struct {
+	factory  TTransportFactory
+	counters tTransportCounters
+}
+
+// A nil factory wraps the transports in a TStatsTransport only.
+func NewTStatsTransportFactory(factory TTransportFactory) *TStatsTransportFactory {
+	return &TStatsTransportFactory{factory: factory}
+}
+
+func (p *TStatsTransportFactory) GetTransport(trans TTransport) TTransport {
+	stats := newTStatsTransport(trans, &p.counters)
+	if p.factory == nil {
+		return stats
+	}
+	return p.factory.GetTransport(stats)
+}
+
+// Returns the sum of the counters of the transports created by p.
+func (p *TStatsTransportFactory) Stats() TTransportStats {
+	return p.counters.stats()
+}
@@ -0,0 +1,95 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsTransportSimpleServer(t *testing.T) {
+	global := GlobalTransportStats()
+	serverStats := NewTStatsTransportFactory(NewTFramedTransportFactory(NewTTransportFactory()))
+	trans := NewTLoopbackServerTransport()
+	server := NewTSimpleServer4(&testEchoProcessor{}, trans, serverStats, NewTBinaryProtocolFactoryDefault())
+	server.SetLogger(NopLogger)
+	trans.Listen()
+	go server.Serve()
+	defer server.Stop()
+
+	clientStats := NewTStatsTransportFactory(NewTFramedTransportFactory(NewTTransportFactory()))
+	client := clientStats.GetTransport(trans.Client(5 * time.Second))
+	if err := client.Open(); err != nil {
+		t.Fatalf("Unable to open client: %s", err)
+	}
+	for i := int32(0); i < 2; i++ {
+		if err := callTestEcho(client, i); err != nil {
+			t.Fatalf("Call %d failed: %s", i, err)
+		}
+	}
+	client.Close()
+
+	// The server sees the end of the connection asynchronously, as the
+	// END_OF_FILE counted for every connection closed by its client.
+	deadline := time.Now().Add(5 * time.Second)
+	for serverStats.Stats().Errors[END_OF_FILE] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the server to count END_OF_FILE, got %+v", serverStats.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c, s := clientStats.Stats(), serverStats.Stats()
+	if c.Flushes != 2 || s.Flushes != 2 {
+		t.Fatalf("Expected 2 flushes on each side, got %d and %d", c.Flushes, s.Flushes)
+	}
+	if c.BytesWritten == 0 || c.BytesWritten != s.BytesRead || s.BytesWritten != c.BytesRead {
+		t.Fatalf("Client and server disagree on the bytes sent: %+v and %+v", c, s)
+	}
+	if c.Reads == 0 || c.MeanReadLatency() <= 0 || c.Errors[END_OF_FILE] != 0 {
+		t.Fatalf("Unexpected client stats %+v", c)
+	}
+	g := GlobalTransportStats()
+	if g.BytesRead-global.BytesRead < c.BytesRead+s.BytesRead {
+		t.Fatalf("Expected the global stats to include both sides, got %+v", g)
+	}
+}
+
+func TestStatsTransport(t *testing.T) {
+	buf := NewTMemoryBuffer()
+	trans := NewTStatsTransport(buf)
+	trans.Write([]byte("hello"))
+	trans.Flush()
+	trans.Read(make([]byte, 3))
+	trans.Read(make([]byte, 3))
+	_, err := trans.Read(make([]byte, 3))
+	if err == nil {
+		t.Fatal("Expected a read from the empty buffer to fail")
+	}
+	s := trans.Stats()
+	if s.BytesWritten != 5 || s.BytesRead != 5 || s.Writes != 1 || s.Reads != 3 || s.Flushes != 1 {
+		t.Fatalf("Unexpected stats %+v", s)
+	}
+	if s.Errors[END_OF_FILE] != 1 {
+		t.Fatalf("Expected one END_OF_FILE error, got %v", s.Errors)
+	}
+	if trans.Transport() != buf {
+		t.Fatal("Expected the wrapped transport")
+	}
+}
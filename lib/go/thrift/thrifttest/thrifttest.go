@@ -0,0 +1,209 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package thrifttest provides utilities for testing Thrift services.
+//
+// A Server runs a TProcessor behind a TSimpleServer, either in memory or on
+// a free local port, and hands out ready client transports with the same
+// transport and protocol stack:
+//
+//	func TestAdd(t *testing.T) {
+//		server := thrifttest.NewServer(t, tutorial.NewCalculatorProcessor(handler), nil)
+//		trans, _ := server.Client()
+//		client := tutorial.NewCalculatorClientFactory(trans, server.ProtocolFactory)
+//		...
+//	}
+//
+// Everything is shut down when the test finishes.
+package thrifttest
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"git.apache.org/thrift.git/lib/go/thrift"
+)
+
+// Options configures a Server. The zero value serves the binary protocol
+// over an unwrapped in-memory transport.
+type Options struct {
+	// Wraps both the server and the client transports, e.g. a
+	// TFramedTransportFactory.
+	TransportFactory thrift.TTransportFactory
+	ProtocolFactory  thrift.TProtocolFactory
+	// Listen on a free port of 127.0.0.1 instead of in memory.
+	Network bool
+	// Read and write timeout of the client transports. Defaults to 10s so
+	// that a hanging server fails the test instead of blocking it.
+	Timeout time.Duration
+}
+
+// Server is a running Thrift server under test.
+type Server struct {
+	TServer          *thrift.TSimpleServer
+	ServerTransport  thrift.TServerTransport
+	TransportFactory thrift.TTransportFactory
+	ProtocolFactory  thrift.TProtocolFactory
+
+	t        testing.TB
+	addr     net.Addr
+	loopback *thrift.TLoopbackServerTransport
+	timeout  time.Duration
+	served   chan error
+
+	mu      sync.Mutex
+	errors  []error
+	clients []thrift.TTransport
+	closed  bool
+}
+
+// NewServer starts serving processor and arranges for the server and every
+// client created from it to be closed when the test and its subtests
+// complete.
+func NewServer(t testing.TB, processor thrift.TProcessor, opts *Options) *Server {
+	t.Helper()
+	if opts == nil {
+		opts = &Options{}
+	}
+	s := &Server{
+		TransportFactory: opts.TransportFactory,
+		ProtocolFactory:  opts.ProtocolFactory,
+		t:                t,
+		timeout:          opts.Timeout,
+		served:           make(chan error, 1),
+	}
+	if s.TransportFactory == nil {
+		s.TransportFactory = thrift.NewTTransportFactory()
+	}
+	if s.ProtocolFactory == nil {
+		s.ProtocolFactory = thrift.NewTBinaryProtocolFactoryDefault()
+	}
+	if s.timeout == 0 {
+		s.timeout = 10 * time.Second
+	}
+
+	if opts.Network {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("thrifttest: unable to listen: %s", err)
+		}
+		s.addr = l.Addr()
+		s.ServerTransport = thrift.NewTServerSocketFromListener(l, 0)
+	} else {
+		s.loopback = thrift.NewTLoopbackServerTransport()
+		s.ServerTransport = s.loopback
+	}
+	// Listen before serving so that clients can connect as soon as
+	// NewServer returns.
+	if err := s.ServerTransport.Listen(); err != nil {
+		t.Fatalf("thrifttest: unable to listen: %s", err)
+	}
+
+	s.TServer = thrift.NewTSimpleServer4(processor, s.ServerTransport, s.TransportFactory, s.ProtocolFactory)
+	s.TServer.SetLogger(s.log)
+	go func() {
+		s.served <- s.TServer.Serve()
+	}()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Records the errors reported by the server while it is running.
+func (s *Server) log(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.errors = append(s.errors, errors.New(msg))
+	}
+}
+
+// Errors returns the errors the server logged so far, such as processing
+// errors and recovered handler panics.
+func (s *Server) Errors() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]error(nil), s.errors...)
+}
+
+// Addr returns the address of the server, or nil if it runs in memory.
+func (s *Server) Addr() net.Addr {
+	return s.addr
+}
+
+// Client opens a new connection to the server and returns its transport,
+// wrapped by the TransportFactory, and a protocol on top of it. The test
+// fails if the connection cannot be opened.
+func (s *Server) Client() (thrift.TTransport, thrift.TProtocol) {
+	s.t.Helper()
+	var trans thrift.TTransport
+	if s.loopback != nil {
+		trans = s.loopback.Client(s.timeout)
+	} else {
+		trans = thrift.NewTSocketFromAddrTimeout(s.addr, s.timeout)
+	}
+	trans = s.TransportFactory.GetTransport(trans)
+	if err := trans.Open(); err != nil {
+		s.t.Fatalf("thrifttest: unable to connect: %s", err)
+	}
+	s.mu.Lock()
+	s.clients = append(s.clients, trans)
+	s.mu.Unlock()
+	return trans, s.ProtocolFactory.GetProtocol(trans)
+}
+
+// StandardClient opens a new connection to the server and returns a
+// TStandardClient using it.
+func (s *Server) StandardClient() *thrift.TStandardClient {
+	s.t.Helper()
+	trans, _ := s.Client()
+	return thrift.NewTStandardClient(s.ProtocolFactory.GetProtocol(trans), s.ProtocolFactory.GetProtocol(trans))
+}
+
+// Close closes all clients, stops the server and waits for it to return.
+// It is called automatically when the test completes and may be called
+// earlier.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	clients := s.clients
+	s.clients = nil
+	s.mu.Unlock()
+
+	for _, trans := range clients {
+		trans.Close()
+	}
+	s.TServer.Stop()
+	// Unblocks Accept for server transports on which Interrupt does not.
+	s.ServerTransport.Close()
+	select {
+	case err := <-s.served:
+		if err != nil {
+			s.t.Errorf("thrifttest: server failed: %s", err)
+		}
+	case <-time.After(s.timeout):
+		s.t.Errorf("thrifttest: server did not stop within %s", s.timeout)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrifttest
+
+import (
+	"strings"
+	"testing"
+
+	"git.apache.org/thrift.git/lib/go/thrift"
+)
+
+// testValue is a struct with a single i32 field, used as both arguments and
+// result of the test service.
+type testValue struct {
+	Value int32
+}
+
+func (p *testValue) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return err
+	}
+	for {
+		_, typeId, id, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return err
+		}
+		if typeId == thrift.STOP {
+			break
+		}
+		if id == 1 && typeId == thrift.I32 {
+			if p.Value, err = iprot.ReadI32(); err != nil {
+				return err
+			}
+		} else if err := iprot.Skip(typeId); err != nil {
+			return err
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	return iprot.ReadStructEnd()
+}
+
+func (p *testValue) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("value"); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldBegin("value", thrift.I32, 1); err != nil {
+		return err
+	}
+	if err := oprot.WriteI32(p.Value); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return err
+	}
+	return oprot.WriteStructEnd()
+}
+
+// testProcessor doubles the value passed to "double" and panics on "panic".
+type testProcessor struct{}
+
+func (p *testProcessor) Process(in, out thrift.TProtocol) (bool, thrift.TException) {
+	name, _, seqId, err := in.ReadMessageBegin()
+	if err != nil {
+		return false, err
+	}
+	args := &testValue{}
+	if err := args.Read(in); err != nil {
+		return false, err
+	}
+	in.ReadMessageEnd()
+	if name == "panic" {
+		panic("test panic")
+	}
+	args.Value *= 2
+	out.WriteMessageBegin(name, thrift.REPLY, seqId)
+	args.Write(out)
+	out.WriteMessageEnd()
+	return true, out.Flush()
+}
+
+func testDouble(t *testing.T, client thrift.TClient) {
+	result := &testValue{}
+	if err := client.Call("double", &testValue{21}, result); err != nil {
+		t.Fatal("call failed:", err)
+	}
+	if result.Value != 42 {
+		t.Fatalf("double(21) = %d; want 42", result.Value)
+	}
+}
+
+func TestServer(t *testing.T) {
+	stacks := map[string]*Options{
+		"default":        nil,
+		"compact-framed": {TransportFactory: thrift.NewTFramedTransportFactory(thrift.NewTTransportFactory()), ProtocolFactory: thrift.NewTCompactProtocolFactory()},
+		"json-network":   {ProtocolFactory: thrift.NewTJSONProtocolFactory(), Network: true},
+	}
+	for name, opts := range stacks {
+		t.Run(name, func(t *testing.T) {
+			server := NewServer(t, &testProcessor{}, opts)
+			if (server.Addr() != nil) != (opts != nil && opts.Network) {
+				t.Fatalf("unexpected address %v", server.Addr())
+			}
+			testDouble(t, server.StandardClient())
+			// A second connection uses its own client stack.
+			testDouble(t, server.StandardClient())
+			if errs := server.Errors(); len(errs) != 0 {
+				t.Fatalf("unexpected server errors %v", errs)
+			}
+		})
+	}
+}
+
+func TestServerClient(t *testing.T) {
+	server := NewServer(t, &testProcessor{}, nil)
+	trans, prot := server.Client()
+	if !trans.IsOpen() {
+		t.Fatal("client transport is not open")
+	}
+	testDouble(t, thrift.NewTStandardClient(prot, prot))
+	server.Close()
+	if trans.IsOpen() {
+		t.Fatal("client transport is still open after Close")
+	}
+	// Close is idempotent, the cleanup calls it again.
+	server.Close()
+}
+
+func TestServerErrors(t *testing.T) {
+	server := NewServer(t, &testProcessor{}, nil)
+	client := server.StandardClient()
+	err := client.Call("panic", &testValue{1}, &testValue{})
+	if x, ok := err.(thrift.TApplicationException); !ok || x.TypeId() != thrift.INTERNAL_ERROR {
+		t.Fatalf("expected INTERNAL_ERROR, got %v", err)
+	}
+	errs := server.Errors()
+	if len(errs) == 0 || !strings.Contains(errs[0].Error(), "test panic") {
+		t.Fatalf("expected the panic to be captured, got %v", errs)
+	}
+	// The server keeps serving other connections.
+	testDouble(t, server.StandardClient())
+}
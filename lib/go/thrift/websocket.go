@@ -0,0 +1,477 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes and close codes, from RFC 6455.
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+
+	wsCloseNormal        = 1000
+	wsCloseProtocolError = 1002
+	wsCloseTooBig        = 1009
+
+	wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// The Sec-WebSocket-Accept value answering a Sec-WebSocket-Key.
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Whether a comma separated header such as Connection lists the token.
+func wsHeaderContains(header http.Header, name, token string) bool {
+	for _, v := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type TWebSocketOptions struct {
+	// Headers sent with the opening handshake.
+	Header http.Header
+
+	// The TLS configuration used for wss URLs.
+	TLSConfig *tls.Config
+
+	// The timeout for connecting and for every read and write; zero means
+	// no timeout.
+	Timeout time.Duration
+
+	// The largest message accepted. Zero means DEFAULT_MAX_LENGTH.
+	MaxMessageSize int
+
+	// Whether messages are sent as text rather than binary, as expected by
+	// browser clients of the JSON protocols.
+	Text bool
+}
+
+// TWebSocket is a TTransport carrying one Thrift message per WebSocket
+// message. Every Flush sends the buffered bytes as one message, and reads
+// continue with the next message once the current one is consumed.
+//
+// Clients are created by NewTWebSocket; the server ends are returned by
+// TWebSocketServerTransport.Accept and reply with the type, text or binary,
+// of the last message received.
+type TWebSocket struct {
+	conn           net.Conn
+	reader         *bufio.Reader
+	client         bool
+	url            *url.URL
+	options        TWebSocketOptions
+	timeout        time.Duration
+	maxMessageSize int
+	messageType    byte
+	writeBuffer    *bytes.Buffer
+	readBuffer     *bytes.Buffer
+
+	writeLock sync.Mutex
+	closeSent bool
+}
+
+func newTWebSocket(conn net.Conn, reader *bufio.Reader, client bool, timeout time.Duration, maxMessageSize int, text bool) *TWebSocket {
+	if maxMessageSize <= 0 {
+		maxMessageSize = DEFAULT_MAX_LENGTH
+	}
+	var messageType byte = wsOpBinary
+	if text {
+		messageType = wsOpText
+	}
+	return &TWebSocket{
+		conn:           conn,
+		reader:         reader,
+		client:         client,
+		timeout:        timeout,
+		maxMessageSize: maxMessageSize,
+		messageType:    messageType,
+		writeBuffer:    bytes.NewBuffer(make([]byte, 0, 1024)),
+		readBuffer:     &bytes.Buffer{},
+	}
+}
+
+// Creates an unopened client transport for a ws:// or wss:// URL.
+func NewTWebSocket(urlstr string) (*TWebSocket, error) {
+	return NewTWebSocketWithOptions(urlstr, TWebSocketOptions{})
+}
+
+func NewTWebSocketWithOptions(urlstr string, options TWebSocketOptions) (*TWebSocket, error) {
+	u, err := url.Parse(urlstr)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws", "http":
+		u.Scheme = "http"
+	case "wss", "https":
+		u.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("Unsupported WebSocket URL scheme %q", u.Scheme)
+	}
+	p := newTWebSocket(nil, nil, true, options.Timeout, options.MaxMessageSize, options.Text)
+	p.url = u
+	p.options = options
+	return p, nil
+}
+
+// Connects and performs the opening handshake.
+func (p *TWebSocket) Open() error {
+	if p.IsOpen() {
+		return NewTTransportException(ALREADY_OPEN, "WebSocket already connected.")
+	}
+	if p.url == nil {
+		return NewTTransportException(NOT_OPEN, "Cannot reopen an accepted WebSocket.")
+	}
+	host := p.url.Host
+	if p.url.Port() == "" {
+		if p.url.Scheme == "https" {
+			host = net.JoinHostPort(p.url.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(p.url.Hostname(), "80")
+		}
+	}
+	dialer := &net.Dialer{Timeout: p.timeout}
+	var conn net.Conn
+	var err error
+	if p.url.Scheme == "https" {
+		config := &tls.Config{}
+		if p.options.TLSConfig != nil {
+			config = p.options.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = p.url.Hostname()
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, config)
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return NewTTransportException(NOT_OPEN, err.Error())
+	}
+	if err := p.handshake(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+func (p *TWebSocket) handshake(conn net.Conn) error {
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return NewTTransportExceptionFromError(err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req, err := http.NewRequest("GET", p.url.String(), nil)
+	if err != nil {
+		return NewTTransportExceptionFromError(err)
+	}
+	for k, v := range p.options.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if p.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(p.timeout))
+	}
+	if err := req.Write(conn); err != nil {
+		return NewTTransportExceptionFromError(err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return NewTTransportExceptionFromError(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return &THttpTransportException{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if !wsHeaderContains(resp.Header, "Upgrade", "websocket") || resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		return NewTTransportException(NOT_OPEN, "Invalid WebSocket handshake response")
+	}
+	conn.SetDeadline(time.Time{})
+	p.conn = conn
+	p.reader = reader
+	p.closeSent = false
+	p.writeBuffer.Reset()
+	p.readBuffer.Reset()
+	return nil
+}
+
+// Retreive the underlying net.Conn
+func (p *TWebSocket) Conn() net.Conn {
+	return p.conn
+}
+
+// Sets the timeout of every read and write.
+func (p *TWebSocket) SetTimeout(timeout time.Duration) error {
+	p.timeout = timeout
+	return nil
+}
+
+func (p *TWebSocket) IsOpen() bool {
+	return p.conn != nil
+}
+
+func (p *TWebSocket) Peek() bool {
+	return p.IsOpen()
+}
+
+// Sends a close message and closes the connection.
+func (p *TWebSocket) Close() error {
+	if p.conn == nil {
+		return nil
+	}
+	p.writeClose(wsCloseNormal, "")
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+func (p *TWebSocket) Read(buf []byte) (int, error) {
+	if !p.IsOpen() {
+		return 0, NewTTransportException(NOT_OPEN, "Connection not open")
+	}
+	for p.readBuffer.Len() == 0 {
+		if err := p.readMessage(); err != nil {
+			return 0, NewTTransportExceptionFromError(err)
+		}
+	}
+	return p.readBuffer.Read(buf)
+}
+
+// The rest of the current message, which holds the rest of the Thrift
+// message.
+func (p *TWebSocket) remainingBytes() int {
+	return p.readBuffer.Len()
+}
+
+func (p *TWebSocket) Write(buf []byte) (int, error) {
+	return p.writeBuffer.Write(buf)
+}
+
+// Sends the buffered bytes as one message.
+func (p *TWebSocket) Flush() error {
+	if !p.IsOpen() {
+		return NewTTransportException(NOT_OPEN, "Connection not open")
+	}
+	if p.writeBuffer.Len() == 0 {
+		return nil
+	}
+	err := p.writeFrame(p.messageType, p.writeBuffer.Bytes())
+	p.writeBuffer.Reset()
+	return NewTTransportExceptionFromError(err)
+}
+
+// Reads the next data message into the read buffer, answering pings and
+// close messages on the way.
+func (p *TWebSocket) readMessage() error {
+	p.readBuffer.Reset()
+	var messageType byte
+	for {
+		if p.timeout > 0 {
+			p.conn.SetReadDeadline(time.Now().Add(p.timeout))
+		}
+		fin, opcode, payload, err := p.readFrame()
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case wsOpClose:
+			code := wsCloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			p.writeClose(code, "")
+			return io.EOF
+		case wsOpPing:
+			if err := p.writeFrame(wsOpPong, payload); err != nil {
+				return err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpText, wsOpBinary:
+			if messageType != 0 {
+				return p.fail(wsCloseProtocolError, "Data frame inside a fragmented message")
+			}
+			messageType = opcode
+		case wsOpContinuation:
+			if messageType == 0 {
+				return p.fail(wsCloseProtocolError, "Continuation frame outside a message")
+			}
+		default:
+			return p.fail(wsCloseProtocolError, fmt.Sprintf("Unknown opcode %d", opcode))
+		}
+		if p.readBuffer.Len()+len(payload) > p.maxMessageSize {
+			return p.fail(wsCloseTooBig, fmt.Sprintf("Message exceeds the limit of %d bytes", p.maxMessageSize))
+		}
+		p.readBuffer.Write(payload)
+		if fin {
+			if !p.client {
+				p.messageType = messageType
+			}
+			return nil
+		}
+	}
+}
+
+func (p *TWebSocket) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(p.reader, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return fin, opcode, nil, p.fail(wsCloseProtocolError, "Reserved bits set without a negotiated extension")
+	}
+	if masked == p.client {
+		return fin, opcode, nil, p.fail(wsCloseProtocolError, "Frame masking does not match the endpoint")
+	}
+	length := uint64(header[1] & 0x7f)
+	if opcode >= wsOpClose && (!fin || length > 125) {
+		return fin, opcode, nil, p.fail(wsCloseProtocolError, "Invalid control frame")
+	}
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(p.reader, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(p.reader, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > uint64(p.maxMessageSize) {
+		return fin, opcode, nil, p.fail(wsCloseTooBig, fmt.Sprintf("Message exceeds the limit of %d bytes", p.maxMessageSize))
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(p.reader, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(p.reader, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// Writes a single frame, masked when sent by a client.
+func (p *TWebSocket) writeFrame(opcode byte, payload []byte) error {
+	p.writeLock.Lock()
+	defer p.writeLock.Unlock()
+	if p.closeSent {
+		return NewTTransportException(NOT_OPEN, "WebSocket closed")
+	}
+	if opcode == wsOpClose {
+		p.closeSent = true
+	}
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	var maskBit byte
+	if p.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126, byte(len(payload)>>8), byte(len(payload)))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(len(payload)))
+		frame = append(append(frame, maskBit|127), ext[:]...)
+	}
+	if p.client {
+		var mask [4]byte
+		if _, err := io.ReadFull(rand.Reader, mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	if p.timeout > 0 {
+		p.conn.SetWriteDeadline(time.Now().Add(p.timeout))
+	}
+	_, err := p.conn.Write(frame)
+	return err
+}
+
+func (p *TWebSocket) writeClose(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return p.writeFrame(wsOpClose, append(payload, reason...))
+}
+
+// Closes the connection after a protocol violation by the peer.
+func (p *TWebSocket) fail(code int, reason string) error {
+	p.writeClose(code, reason)
+	p.conn.Close()
+	p.conn = nil
+	return NewTTransportException(UNKNOWN_TRANSPORT_EXCEPTION, reason)
+}
@@ -0,0 +1,189 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TWebSocketServerTransport is a TServerTransport accepting WebSocket
+// connections. It is an http.Handler: mount it on an HTTP server, and each
+// upgraded request is returned by Accept as a *TWebSocket to be served by a
+// TServer such as TSimpleServer.
+//
+// Example:
+//
+//	trans := thrift.NewTWebSocketServerTransport()
+//	http.Handle("/thrift", trans)
+//	go http.ListenAndServe(":9090", nil)
+//	thrift.NewTSimpleServer4(processor, trans, thrift.NewTTransportFactory(), protocolFactory).Serve()
+type TWebSocketServerTransport struct {
+	mu             sync.Mutex
+	conns          chan *TWebSocket
+	interrupted    chan struct{}
+	listening      bool
+	clientTimeout  time.Duration
+	maxMessageSize int
+	checkOrigin    func(*http.Request) bool
+}
+
+func NewTWebSocketServerTransport() *TWebSocketServerTransport {
+	return NewTWebSocketServerTransportTimeout(0)
+}
+
+// Creates a TWebSocketServerTransport whose clients time out reads and
+// writes after clientTimeout.
+func NewTWebSocketServerTransportTimeout(clientTimeout time.Duration) *TWebSocketServerTransport {
+	return &TWebSocketServerTransport{
+		conns:          make(chan *TWebSocket),
+		interrupted:    make(chan struct{}),
+		clientTimeout:  clientTimeout,
+		maxMessageSize: DEFAULT_MAX_LENGTH,
+		checkOrigin:    wsSameOrigin,
+	}
+}
+
+// Sets the largest message accepted from clients.
+func (p *TWebSocketServerTransport) SetMaxMessageSize(maxMessageSize int) {
+	p.maxMessageSize = maxMessageSize
+}
+
+// Sets the check of the Origin header of browser clients. By default only
+// requests without an Origin or from the same host are accepted.
+func (p *TWebSocketServerTransport) SetCheckOrigin(checkOrigin func(*http.Request) bool) {
+	if checkOrigin == nil {
+		checkOrigin = wsSameOrigin
+	}
+	p.checkOrigin = checkOrigin
+}
+
+func wsSameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, req.Host)
+}
+
+func (p *TWebSocketServerTransport) Listen() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.listening {
+		p.listening = true
+		p.interrupted = make(chan struct{})
+	}
+	return nil
+}
+
+// Returns the channel closed by the next Close, and whether the transport
+// is listening.
+func (p *TWebSocketServerTransport) stopped() (chan struct{}, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.interrupted, p.listening
+}
+
+func (p *TWebSocketServerTransport) Accept() (TTransport, error) {
+	interrupted, listening := p.stopped()
+	if !listening {
+		return nil, NewTTransportException(NOT_OPEN, "WebSocket server transport not listening")
+	}
+	select {
+	case ws := <-p.conns:
+		return ws, nil
+	case <-interrupted:
+		return nil, errTransportInterrupted
+	}
+}
+
+func (p *TWebSocketServerTransport) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.listening {
+		p.listening = false
+		close(p.interrupted)
+	}
+	return nil
+}
+
+// Interrupt stops listening and unblocks any pending Accept.
+func (p *TWebSocketServerTransport) Interrupt() error {
+	return p.Close()
+}
+
+// Upgrades the request to a WebSocket and hands it to Accept.
+func (p *TWebSocketServerTransport) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	interrupted, listening := p.stopped()
+	if !listening {
+		http.Error(w, "Server not listening", http.StatusServiceUnavailable)
+		return
+	}
+	if req.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "WebSocket handshake requires GET", http.StatusMethodNotAllowed)
+		return
+	}
+	if !wsHeaderContains(req.Header, "Connection", "upgrade") || !wsHeaderContains(req.Header, "Upgrade", "websocket") {
+		http.Error(w, "Not a WebSocket handshake", http.StatusBadRequest)
+		return
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+	if !p.checkOrigin(req) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket upgrade not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The server may have set deadlines for the request.
+	conn.SetDeadline(time.Time{})
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+	ws := newTWebSocket(conn, rw.Reader, false, p.clientTimeout, p.maxMessageSize, false)
+	select {
+	case p.conns <- ws:
+	case <-interrupted:
+		ws.Close()
+	}
+}
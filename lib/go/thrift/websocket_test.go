@@ -0,0 +1,192 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package thrift
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Serves testEchoProcessor over WebSockets with the given protocol.
+func newTestWebSocketServer(t *testing.T, protocolFactory TProtocolFactory) (*TWebSocketServerTransport, string) {
+	trans := NewTWebSocketServerTransportTimeout(5 * time.Second)
+	server := NewTSimpleServer4(&testEchoProcessor{}, trans, NewTTransportFactory(), protocolFactory)
+	server.SetLogger(NopLogger)
+	if err := trans.Listen(); err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	httpServer := httptest.NewServer(trans)
+	go server.Serve()
+	t.Cleanup(func() {
+		server.Stop()
+		httpServer.Close()
+	})
+	return trans, "ws" + strings.TrimPrefix(httpServer.URL, "http")
+}
+
+func TestWebSocket(t *testing.T) {
+	_, url := newTestWebSocketServer(t, NewTBinaryProtocolFactoryDefault())
+
+	client, err := NewTWebSocketWithOptions(url, TWebSocketOptions{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Unable to create client: %s", err)
+	}
+	if err := client.Open(); err != nil {
+		t.Fatalf("Unable to open %s: %s", url, err)
+	}
+	defer client.Close()
+	p := NewTBinaryProtocolTransport(client)
+	c := NewTStandardClient(p, p)
+	// Several calls share the connection.
+	for _, value := range []int32{1, 2, 3} {
+		result := &testCallStruct{}
+		if err := c.Call("echo", &testCallStruct{value}, result); err != nil {
+			t.Fatalf("Call %d failed: %s", value, err)
+		}
+		if result.Value != value {
+			t.Fatalf("Expected %d, got %d", value, result.Value)
+		}
+	}
+
+	// Pings are answered in between messages.
+	if err := client.writeFrame(wsOpPing, []byte("ping")); err != nil {
+		t.Fatalf("Unable to ping: %s", err)
+	}
+	result := &testCallStruct{}
+	if err := c.Call("echo", &testCallStruct{4}, result); err != nil || result.Value != 4 {
+		t.Fatalf("Call after ping failed: %v %d", err, result.Value)
+	}
+}
+
+func TestWebSocketText(t *testing.T) {
+	_, url := newTestWebSocketServer(t, NewTJSONProtocolFactory())
+	client, _ := NewTWebSocketWithOptions(url, TWebSocketOptions{Text: true, Timeout: 5 * time.Second})
+	if err := client.Open(); err != nil {
+		t.Fatalf("Unable to open %s: %s", url, err)
+	}
+	defer client.Close()
+	p := NewTJSONProtocol(client)
+	result := &testCallStruct{}
+	if err := NewTStandardClient(p, p).Call("echo", &testCallStruct{5}, result); err != nil || result.Value != 5 {
+		t.Fatalf("Call failed: %v %d", err, result.Value)
+	}
+	if client.messageType != wsOpText {
+		t.Fatalf("Expected text messages, got opcode %d", client.messageType)
+	}
+}
+
+func TestWebSocketMessageTooBig(t *testing.T) {
+	trans, url := newTestWebSocketServer(t, NewTBinaryProtocolFactoryDefault())
+	trans.SetMaxMessageSize(16)
+	client, _ := NewTWebSocketWithOptions(url, TWebSocketOptions{Timeout: 5 * time.Second})
+	if err := client.Open(); err != nil {
+		t.Fatalf("Unable to open %s: %s", url, err)
+	}
+	defer client.Close()
+	client.Write(make([]byte, 17))
+	client.Flush()
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Expected the server to close the connection")
+	}
+}
+
+func TestWebSocketHandshakeRejected(t *testing.T) {
+	_, url := newTestWebSocketServer(t, NewTBinaryProtocolFactoryDefault())
+	httpURL := "http" + strings.TrimPrefix(url, "ws")
+
+	resp, err := http.Get(httpURL)
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for a plain GET, got %d", resp.StatusCode)
+	}
+
+	client, _ := NewTWebSocketWithOptions(url, TWebSocketOptions{
+		Header: http.Header{"Origin": {"http://elsewhere.example"}},
+	})
+	err = client.Open()
+	if e, ok := err.(*THttpTransportException); !ok || e.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected 403 for a foreign origin, got %v", err)
+	}
+	if client.IsOpen() {
+		t.Fatal("Expected the client to stay closed")
+	}
+}
+
+// A masked client frame with a zero mask, which leaves the payload as is.
+func testWebSocketFrame(fin bool, opcode byte, payload []byte) []byte {
+	if fin {
+		opcode |= 0x80
+	}
+	return append([]byte{opcode, 0x80 | byte(len(payload)), 0, 0, 0, 0}, payload...)
+}
+
+func TestWebSocketFragmentedMessage(t *testing.T) {
+	_, url := newTestWebSocketServer(t, NewTBinaryProtocolFactoryDefault())
+	client, _ := NewTWebSocketWithOptions(url, TWebSocketOptions{Timeout: 5 * time.Second})
+	if err := client.Open(); err != nil {
+		t.Fatalf("Unable to open %s: %s", url, err)
+	}
+	defer client.Close()
+	call := NewTMemoryBuffer()
+	writeTestCall(t, call, "echo", 1, 6)
+	data := call.Bytes()
+	var frames []byte
+	frames = append(frames, testWebSocketFrame(false, wsOpBinary, data[:5])...)
+	frames = append(frames, testWebSocketFrame(true, wsOpPing, nil)...)
+	frames = append(frames, testWebSocketFrame(true, wsOpContinuation, data[5:])...)
+	if _, err := client.Conn().Write(frames); err != nil {
+		t.Fatalf("Unable to write frames: %s", err)
+	}
+	p := NewTBinaryProtocolTransport(client)
+	result := &testCallStruct{}
+	if err := NewTStandardClient(p, p).Recv(p, 1, "echo", result); err != nil || result.Value != 6 {
+		t.Fatalf("Unexpected reply: %v %d", err, result.Value)
+	}
+}
+
+func TestWebSocketBadFrameCloses(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	go func() {
+		// Clients must mask their frames, so the server rejects this one.
+		peer.Write([]byte{0x80 | wsOpBinary, 1, 0})
+		io.Copy(ioutil.Discard, peer)
+	}()
+	server := newTWebSocket(conn, bufio.NewReader(conn), false, 5*time.Second, 0, false)
+	if _, err := server.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Expected an unmasked client frame to fail")
+	}
+	if server.IsOpen() {
+		t.Fatal("Expected the transport to be closed after a protocol error")
+	}
+	if _, err := server.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Expected Read() on the closed transport to fail")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements. See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership. The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License. You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied. See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+import (
+	"git.apache.org/thrift.git/lib/go/thrift"
+	"git.apache.org/thrift.git/lib/go/thrift/thrifttest"
+	"testing"
+	"tutorial"
+)
+
+func newTestCalculatorClient(t *testing.T, opts *thrifttest.Options) *tutorial.CalculatorClient {
+	server := thrifttest.NewServer(t, tutorial.NewCalculatorProcessor(NewCalculatorHandler()), opts)
+	trans, _ := server.Client()
+	return tutorial.NewCalculatorClientFactory(trans, server.ProtocolFactory)
+}
+
+func TestCalculator(t *testing.T) {
+	stacks := map[string]*thrifttest.Options{
+		"binary":         nil,
+		"compact-framed": {TransportFactory: thrift.NewTFramedTransportFactory(thrift.NewTTransportFactory()), ProtocolFactory: thrift.NewTCompactProtocolFactory()},
+		"json-network":   {ProtocolFactory: thrift.NewTJSONProtocolFactory(), Network: true},
+	}
+	for name, opts := range stacks {
+		t.Run(name, func(t *testing.T) {
+			client := newTestCalculatorClient(t, opts)
+			if err := client.Ping(); err != nil {
+				t.Fatal("ping:", err)
+			}
+			if sum, err := client.Add(1, 1); err != nil || sum != 2 {
+				t.Fatalf("add(1, 1) = %d, %v; want 2", sum, err)
+			}
+
+			work := tutorial.NewWork()
+			work.Op = tutorial.Operation_SUBTRACT
+			work.Num1 = 15
+			work.Num2 = 10
+			if diff, ouch, err := client.Calculate(1, work); err != nil || ouch != nil || diff != 5 {
+				t.Fatalf("calculate(15 - 10) = %d, %v, %v; want 5", diff, ouch, err)
+			}
+			if log, err := client.GetStruct(1); err != nil || log == nil || log.Value != "5" {
+				t.Fatalf("getStruct(1) = %v, %v; want 5", log, err)
+			}
+		})
+	}
+}
+
+func TestCalculatorInvalidOperation(t *testing.T) {
+	client := newTestCalculatorClient(t, nil)
+	work := tutorial.NewWork()
+	work.Op = tutorial.Operation_DIVIDE
+	work.Num1 = 1
+	work.Num2 = 0
+	_, ouch, err := client.Calculate(1, work)
+	if err != nil {
+		t.Fatal("calculate:", err)
+	}
+	if ouch == nil || ouch.What != int32(tutorial.Operation_DIVIDE) {
+		t.Fatalf("calculate(1 / 0) returned %v; want InvalidOperation", ouch)
+	}
+}